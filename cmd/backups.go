@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"macsetup/internal/installer"
+	"macsetup/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+func newBackupsCmd() *cobra.Command {
+	backups := &cobra.Command{
+		Use:   "backups",
+		Short: "List, restore and prune the backups made before files were rewritten",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List backups by file and run",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			all, err := installer.LoadBackups()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(all) == 0 {
+				_, _ = fmt.Fprintln(out, "no backups recorded")
+				return nil
+			}
+			var targets []string
+			byTarget := make(map[string][]installer.Backup)
+			for _, b := range all {
+				if _, ok := byTarget[b.Target]; !ok {
+					targets = append(targets, b.Target)
+				}
+				byTarget[b.Target] = append(byTarget[b.Target], b)
+			}
+			for _, target := range targets {
+				_, _ = fmt.Fprintln(out, target)
+				run := ""
+				for _, b := range byTarget[target] {
+					if b.Run != run {
+						run = b.Run
+						_, _ = fmt.Fprintf(out, "  run %s\n", run)
+					}
+					missing := ""
+					if b.OldTarget == "" && !utils.Exists(b.Path) {
+						missing = " (missing)"
+					}
+					_, _ = fmt.Fprintf(out, "    %s  %s%s\n", b.Stamp(), b.Source(), missing)
+				}
+			}
+			return nil
+		},
+	}
+
+	restore := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Put a backup of file back in place (the newest unless --at is given)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			at, _ := cmd.Flags().GetString("at")
+			target, err := utils.ExpandHome(args[0])
+			if err != nil {
+				return err
+			}
+			if target, err = filepath.Abs(target); err != nil {
+				return err
+			}
+			b, err := installer.RestoreBackup(target, at)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "restored %s from %s\n", target, b.Source())
+			return nil
+		},
+	}
+	restore.Flags().String("at", "", "Restore the backup with this timestamp or run (a prefix is enough, e.g. 20250101_1200)")
+
+	prune := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old backups",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			keep, _ := cmd.Flags().GetInt("keep")
+			olderThan, _ := cmd.Flags().GetDuration("older-than")
+			if !cmd.Flags().Changed("keep") && !cmd.Flags().Changed("older-than") {
+				return fmt.Errorf("give --keep, --older-than or both")
+			}
+			if keep < 0 {
+				return fmt.Errorf("--keep must not be negative")
+			}
+			pruned, err := installer.PruneBackups(keep, olderThan)
+			for _, b := range pruned {
+				if b.OldTarget != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "forgot %s was a symlink to %s\n", b.Target, b.OldTarget)
+					continue
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", b.Path)
+			}
+			if err == nil && len(pruned) == 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "nothing to prune")
+			}
+			return err
+		},
+	}
+	prune.Flags().Int("keep", 0, "Keep this many of the newest backups of each file")
+	prune.Flags().Duration("older-than", 0, "Only delete backups older than this (e.g. 720h)")
+
+	backups.AddCommand(list, restore, prune)
+	return backups
+}
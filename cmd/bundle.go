@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"macsetup/internal/config"
+	"macsetup/internal/constants"
+	"macsetup/internal/installer"
+
+	"github.com/spf13/cobra"
+)
+
+func newBundleCmd() *cobra.Command {
+	bundle := &cobra.Command{
+		Use:   "bundle",
+		Short: "Manage offline install bundles",
+	}
+
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Download everything needed for an offline install",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			dir, _ := cmd.Flags().GetString("dir")
+			all, _ := cmd.Flags().GetBool("all")
+
+			settings, err := loadSettings(cmd)
+			if err != nil {
+				return err
+			}
+			if err := installer.ApplyNetwork(settings.Network); err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			selection := installer.DefaultSelection()
+			if all {
+				selection = make(map[string]bool)
+				for _, pkg := range config.AllPackages() {
+					selection[pkg.Name] = true
+				}
+			}
+			_, err = installer.CreateBundle(ctx, dir, selection, settings, cmd.OutOrStdout())
+			return err
+		},
+	}
+	create.Flags().String("dir", constants.DefaultBundleDir, "Directory to write the bundle to")
+	create.Flags().Bool("all", false, "Bundle every package in the catalog, not just the default selection")
+
+	bundle.AddCommand(create)
+	return bundle
+}
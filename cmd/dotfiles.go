@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"macsetup/internal/installer"
+
+	"github.com/spf13/cobra"
+)
+
+func newDotfilesCmd() *cobra.Command {
+	dotfiles := &cobra.Command{
+		Use:   "dotfiles",
+		Short: "Manage the configs macsetup writes",
+	}
+
+	diff := &cobra.Command{
+		Use:   "diff",
+		Short: "Show what writing the dotfiles would change, without writing anything",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			flag, _ := cmd.Flags().GetString("mode")
+
+			settings, err := loadSettings(cmd)
+			if err != nil {
+				return err
+			}
+			dotfiles, err := dotfilesSettings(settings, flag, dotfilesFlag(cmd, "files"))
+			if err != nil {
+				return err
+			}
+			data := installer.NewTemplateData(cmd.Context(), dotfiles, installer.DefaultSelection())
+			changes, err := installer.PlanDotfiles(cmd.Context(), dotfiles, data)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			switch format {
+			case "text":
+				printDotfilesDiff(out, changes)
+				return nil
+			case "json":
+				return printDotfilesJSON(out, changes)
+			default:
+				return fmt.Errorf("unknown format %q (want text or json)", format)
+			}
+		},
+	}
+	diff.Flags().String("format", "text", "Output format: text (unified diff) or json (changed paths)")
+	diff.Flags().String("mode", "", "Preview this dotfiles mode, merge, replace or link (default from config, else merge)")
+	diff.Flags().StringSlice("files", nil, "Only these dotfiles, e.g. zshrc,tmux (default from config, else all)")
+
+	remove := &cobra.Command{
+		Use:   "remove",
+		Short: "Take macsetup's managed blocks out of your configs, keeping everything else",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			settings, err := loadSettings(cmd)
+			if err != nil {
+				return err
+			}
+			dotfiles, err := dotfilesSettings(settings, "", dotfilesFlag(cmd, "files"))
+			if err != nil {
+				return err
+			}
+			changed, err := installer.RemoveDotfiles(cmd.Context(), dotfiles)
+			for _, path := range changed {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "removed managed block from %s\n", path)
+			}
+			if err == nil && len(changed) == 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "no managed blocks found")
+			}
+			return err
+		},
+	}
+
+	remove.Flags().StringSlice("files", nil, "Only these dotfiles, e.g. zshrc,tmux (default from config, else all)")
+
+	dotfiles.AddCommand(diff, remove)
+	return dotfiles
+}
+
+// printDotfilesDiff writes a unified diff for every planned change.
+func printDotfilesDiff(out io.Writer, changes []installer.DotfileChange) {
+	n := 0
+	for _, c := range changes {
+		if c.Action == installer.DotfileUnchanged {
+			continue
+		}
+		_, _ = io.WriteString(out, c.Diff())
+		n++
+	}
+	if n == 0 {
+		_, _ = fmt.Fprintln(out, "dotfiles are up to date")
+	}
+}
+
+type dotfileChangeJSON struct {
+	Path    string                  `json:"path"`
+	Action  installer.DotfileAction `json:"action"`
+	Added   int                     `json:"added,omitempty"`
+	Removed int                     `json:"removed,omitempty"`
+	Target  string                  `json:"target,omitempty"`
+}
+
+// printDotfilesJSON lists the paths that would change.
+func printDotfilesJSON(out io.Writer, changes []installer.DotfileChange) error {
+	list := []dotfileChangeJSON{}
+	for _, c := range changes {
+		if c.Action == installer.DotfileUnchanged {
+			continue
+		}
+		added, removed := c.Stat()
+		list = append(list, dotfileChangeJSON{Path: c.Path, Action: c.Action, Added: added, Removed: removed, Target: c.Target})
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Changes []dotfileChangeJSON `json:"changes"`
+	}{list})
+}
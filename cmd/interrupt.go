@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"macsetup/internal/installer"
+)
+
+// handleInterrupts turns the first SIGINT or SIGTERM into a graceful stop
+// (see installer.WithStop) and the second into cancelling the context, which
+// kills whatever is still running. notify is called on the first signal.
+// The returned function stops listening.
+func handleInterrupts(parent context.Context, notify func()) (context.Context, func()) {
+	ctx, kill := context.WithCancel(parent)
+	ctx, stop := installer.WithStop(ctx)
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+		case <-ctx.Done():
+			return
+		}
+		stop()
+		notify()
+		select {
+		case <-sigs:
+			kill()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		kill()
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"macsetup/internal/config"
+	"macsetup/internal/constants"
 	"macsetup/internal/installer"
 	"macsetup/internal/tui"
 	"macsetup/internal/utils"
@@ -16,6 +19,15 @@ import (
 )
 
 func Execute(version, commit, date string) {
+	err := newRootCmd(version, commit, date).Execute()
+	installer.RemoveDotfileClones()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func newRootCmd(version, commit, date string) *cobra.Command {
 	root := &cobra.Command{
 		Use:           "macsetup",
 		Short:         "Team macOS onboarding setup tool",
@@ -28,7 +40,17 @@ func Execute(version, commit, date string) {
 			logFile, _ := cmd.Flags().GetString("log-file")
 			verbose, _ := cmd.Flags().GetBool("verbose")
 
-			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			opts, err := runOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			opts.Verbose = verbose
+
+			ctx, stop := handleInterrupts(cmd.Context(), func() {
+				if headless {
+					_, _ = fmt.Fprintln(os.Stderr, "\nInterrupted: letting running steps finish. Press Ctrl+C again to stop them now.")
+				}
+			})
 			defer stop()
 
 			var out io.Writer = os.Stdout
@@ -40,13 +62,14 @@ func Execute(version, commit, date string) {
 				}
 				defer func() { _ = f.Close() }()
 				logWriter = f
+				opts.Log = f
 				if headless {
 					out = io.MultiWriter(os.Stdout, f)
 				}
 			}
 
 			if dryRun {
-				return runDryRun(ctx, out)
+				return runDryRun(ctx, out, opts)
 			}
 
 			if err := utils.PreflightChecks(ctx); err != nil {
@@ -55,17 +78,21 @@ func Execute(version, commit, date string) {
 
 			if headless {
 				selection := installer.DefaultSelection()
-				summary, err := installer.RunInstallPlan(ctx, selection, workers, out, installer.RunOptions{Verbose: verbose})
+				summary, err := installer.RunInstallPlan(ctx, selection, workers, out, opts)
 				if err != nil {
 					return err
 				}
+				printSummary(out, summary, opts.Checkpoint)
+				if n := summary.CancelledCount(); n > 0 {
+					return fmt.Errorf("interrupted: %d steps not started", n)
+				}
 				if summary.FailedCount() > 0 {
 					return fmt.Errorf("%d steps failed", summary.FailedCount())
 				}
 				return nil
 			}
 
-			return tui.Run(ctx, workers, verbose, logWriter)
+			return tui.Run(ctx, workers, opts, logWriter)
 		},
 	}
 
@@ -73,10 +100,18 @@ func Execute(version, commit, date string) {
 	root.SetVersionTemplate("macsetup {{.Version}}\n")
 
 	root.Flags().Bool("headless", false, "Run without TUI using default selections")
-	root.Flags().Int("workers", 5, "Max parallel formula installs")
+	root.Flags().Int("workers", 5, "Max parallel downloads (brew fetch) before the serialized installs")
 	root.Flags().BoolP("dry-run", "n", false, "Show what would be installed without making changes")
-	root.Flags().String("log-file", "", "Write detailed logs to this file (headless mode)")
+	root.Flags().String("log-file", "", "Write progress and the full output of every command to this file")
 	root.Flags().BoolP("verbose", "v", false, "Verbose output (more details for debugging)")
+	root.PersistentFlags().String("config", "", "Path to a JSON config file (default ~/.config/macsetup/config.json)")
+	root.Flags().String("adopt", string(config.AdoptSkip), "What to do with apps already in /Applications but not managed by Homebrew: skip, adopt or replace")
+	root.Flags().StringToString("adopt-package", nil, "Per-cask adoption policy overrides (e.g. zoom=replace,slack=adopt)")
+	root.Flags().Bool("batch", false, "Install all formulas (and all casks) with a single brew install, retrying failures one by one")
+	root.Flags().Duration("deadline", 0, "Stop the installation after this long (e.g. 2h); unfinished steps fail with a timeout")
+	root.Flags().StringSlice("dotfiles", nil, "Dotfiles to write, e.g. zshrc,tmux (all or none; default from config, else all)")
+	root.Flags().String("dotfiles-mode", "", "How to write dotfiles: merge (only a managed block in each file), replace or link (symlinks to the team files) (default from config, else merge)")
+	root.Flags().String("offline", "", "Install from this offline bundle directory (see `macsetup bundle create`); --offline= uses ./"+constants.DefaultBundleDir)
 
 	root.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -86,18 +121,214 @@ func Execute(version, commit, date string) {
 		},
 	})
 
-	if err := root.Execute(); err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(1)
+	root.AddCommand(newBundleCmd())
+	root.AddCommand(newDotfilesCmd())
+	root.AddCommand(newBackupsCmd())
+	return root
+}
+
+// offlineDir returns the bundle directory --offline names, the default one
+// for an empty value, or "" when the flag was not given.
+func offlineDir(cmd *cobra.Command) string {
+	if !cmd.Flags().Changed("offline") {
+		return ""
+	}
+	if dir, _ := cmd.Flags().GetString("offline"); dir != "" {
+		return dir
 	}
+	return constants.DefaultBundleDir
 }
 
-func runDryRun(ctx context.Context, out io.Writer) error {
+func runOptionsFromFlags(cmd *cobra.Command) (installer.RunOptions, error) {
+	var opts installer.RunOptions
+
+	settings, err := loadSettings(cmd)
+	if err != nil {
+		return opts, err
+	}
+	if err := installer.ApplyNetwork(settings.Network); err != nil {
+		return opts, err
+	}
+	opts.Sources = settings.ResolvedSources()
+	opts.Batch, _ = cmd.Flags().GetBool("batch")
+	opts.Timeouts = settings.Timeouts
+	opts.Deadline, _ = cmd.Flags().GetDuration("deadline")
+
+	flag, _ := cmd.Flags().GetString("dotfiles-mode")
+	if opts.Dotfiles, err = dotfilesSettings(settings, flag, dotfilesFlag(cmd, "dotfiles")); err != nil {
+		return opts, err
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		opts.Checkpoint = filepath.Join(home, constants.CheckpointPath)
+	}
+
+	if dir := offlineDir(cmd); dir != "" {
+		bundle, err := installer.OpenBundle(dir)
+		if err != nil {
+			return opts, err
+		}
+		if err := installer.ApplyOffline(bundle); err != nil {
+			return opts, err
+		}
+		opts.Sources = bundle.Sources(opts.Sources)
+		if opts.Dotfiles.Source, err = bundle.DotfilesSource(opts.Dotfiles.Source); err != nil {
+			return opts, err
+		}
+		opts.Bundle = bundle
+	}
+
+	adopt, _ := cmd.Flags().GetString("adopt")
+	policy, err := config.ParseAdoptPolicy(adopt)
+	if err != nil {
+		return opts, err
+	}
+	opts.Adopt = policy
+
+	overrides, _ := cmd.Flags().GetStringToString("adopt-package")
+	for name, value := range overrides {
+		p, err := config.ParseAdoptPolicy(value)
+		if err != nil {
+			return opts, fmt.Errorf("--adopt-package %s: %w", name, err)
+		}
+		if opts.AdoptOverrides == nil {
+			opts.AdoptOverrides = make(map[string]config.AdoptPolicy)
+		}
+		opts.AdoptOverrides[name] = p
+	}
+	return opts, nil
+}
+
+// dotfilesSettings returns the dotfiles settings with the mode named by flag,
+// falling back to the config file and then to config.DotfilesMerge, and with
+// files, when not nil, choosing the files. A git source goes through the
+// configured mirrors like every other download.
+func dotfilesSettings(settings config.Settings, flag string, files []string) (config.Dotfiles, error) {
+	d := settings.Dotfiles
+	if flag != "" {
+		d.Mode = config.DotfilesMode(flag)
+	}
+	if files != nil {
+		d.Files = files
+	}
+	if d.Mode == "" {
+		d.Mode = config.DotfilesMerge
+	}
+	mode, err := config.ParseDotfilesMode(string(d.Mode))
+	if err != nil {
+		return d, err
+	}
+	d.Mode = mode
+	if d.Source.URL != "" {
+		d.Source = settings.Network.RewriteAsset(d.Source)
+	}
+	return d, nil
+}
+
+// dotfilesFlag returns the files a --dotfiles style flag chooses: nil when it
+// was not given or says "all", empty for "none".
+func dotfilesFlag(cmd *cobra.Command, name string) []string {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	files, _ := cmd.Flags().GetStringSlice(name)
+	switch {
+	case len(files) == 1 && files[0] == "all":
+		return nil
+	case len(files) == 1 && files[0] == "none":
+		return []string{}
+	}
+	return files
+}
+
+// loadSettings reads --config, or ~/.config/macsetup/config.json when it exists.
+func loadSettings(cmd *cobra.Command) (config.Settings, error) {
+	path, _ := cmd.Flags().GetString("config")
+	if path != "" {
+		return config.LoadSettings(path, true)
+	}
+	path, err := config.DefaultSettingsPath()
+	if err != nil {
+		return config.DefaultSettings(), nil
+	}
+	return config.LoadSettings(path, false)
+}
+
+// printSummary reports how a headless run ended.
+func printSummary(out io.Writer, s installer.Summary, checkpoint string) {
+	counts := make(map[installer.InstallStatus]int)
+	for _, r := range s.Results {
+		counts[r.Status]++
+	}
+	_, _ = fmt.Fprintf(out, "\nSummary: %d installed, %d adopted, %d skipped, %d failed, %d cancelled\n",
+		counts[installer.StatusInstalled], counts[installer.StatusAdopted], counts[installer.StatusSkipped],
+		counts[installer.StatusFailed], counts[installer.StatusCancelled])
+	if counts[installer.StatusCancelled] > 0 {
+		_, _ = fmt.Fprintln(out, "Not started:")
+		for _, r := range s.Results {
+			if r.Status == installer.StatusCancelled {
+				_, _ = fmt.Fprintf(out, "  - %s\n", r.Package.Name)
+			}
+		}
+	}
+	var retried []installer.InstallResult
+	for _, r := range s.Results {
+		if len(r.Retries) > 0 {
+			retried = append(retried, r)
+		}
+	}
+	if len(retried) > 0 {
+		_, _ = fmt.Fprintln(out, "Retried:")
+		for _, r := range retried {
+			for _, ca := range r.Retries {
+				_, _ = fmt.Fprintf(out, "  - %s (%s): %d attempt(s), %s\n", r.Package.Name, ca.Command, ca.Attempts, r.Status)
+				for _, e := range ca.Errors {
+					_, _ = fmt.Fprintf(out, "      %s\n", strings.SplitN(e, "\n", 2)[0])
+				}
+			}
+		}
+	}
+	if download, install := s.BrewTimes(); download > 0 {
+		_, _ = fmt.Fprintf(out, "Homebrew: %s downloading (in parallel), %s installing\n",
+			download.Round(time.Second), install.Round(time.Second))
+	}
+	if checkpoint != "" {
+		if err := s.CheckpointError(); err != "" {
+			_, _ = fmt.Fprintf(out, "Checkpoint could not be saved to %s: %s\n", checkpoint, err)
+		} else {
+			_, _ = fmt.Fprintf(out, "Checkpoint saved to %s\n", checkpoint)
+		}
+	}
+}
+
+func runDryRun(ctx context.Context, out io.Writer, opts installer.RunOptions) error {
 	selection := installer.DefaultSelection()
-	plan := installer.DryRunPlan(ctx, selection)
+	plan := installer.DryRunPlan(ctx, selection, opts)
 	_, _ = fmt.Fprintln(out, "Dry run: planned steps")
 	for _, line := range plan {
 		_, _ = fmt.Fprintln(out, "- "+line)
 	}
+	changes, err := installer.PlanDotfiles(ctx, opts.Dotfiles, installer.NewTemplateData(ctx, opts.Dotfiles, selection))
+	printDotfilesPlan(out, changes, err, opts.Verbose)
 	return nil
 }
+
+// printDotfilesPlan lists what writing the dotfiles would do to each file,
+// followed by the full diff when verbose.
+func printDotfilesPlan(out io.Writer, changes []installer.DotfileChange, err error, verbose bool) {
+	_, _ = fmt.Fprintln(out, "\nDotfiles:")
+	switch {
+	case err != nil:
+		_, _ = fmt.Fprintf(out, "- could not preview dotfiles: %s\n", err)
+		return
+	case len(changes) == 0:
+		_, _ = fmt.Fprintln(out, "- no files selected")
+		return
+	}
+	for _, c := range changes {
+		_, _ = fmt.Fprintln(out, "- "+c.Summary())
+	}
+	if verbose {
+		_, _ = fmt.Fprintln(out, "\nDotfiles diff:")
+		printDotfilesDiff(out, changes)
+	}
+}
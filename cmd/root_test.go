@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"macsetup/internal/config"
+	"macsetup/internal/constants"
+	"macsetup/internal/installer"
+
+	"github.com/spf13/cobra"
+)
+
+func TestOfflineFlag(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "value after a space", args: []string{"--offline", "/tmp/bundle"}, want: "/tmp/bundle"},
+		{name: "value after =", args: []string{"--offline=/tmp/bundle"}, want: "/tmp/bundle"},
+		{name: "empty value", args: []string{"--offline="}, want: constants.DefaultBundleDir},
+		{name: "with other flags", args: []string{"--offline", "bundle", "--headless"}, want: "bundle"},
+		{name: "not given", args: []string{"--headless"}, want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := newRootCmd("test", "none", "unknown")
+			got := "unset"
+			root.RunE = func(cmd *cobra.Command, _ []string) error {
+				got = offlineDir(cmd)
+				return nil
+			}
+			root.SetArgs(tc.args)
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %q want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPrintSummaryCheckpoint(t *testing.T) {
+	saved := installer.Summary{}
+	failed := installer.Summary{Results: []installer.InstallResult{{
+		Package: config.Package{Name: "Save checkpoint", Type: config.TypeTask},
+		Status:  installer.StatusFailed,
+		Error:   "permission denied",
+	}}}
+	cases := []struct {
+		name    string
+		summary installer.Summary
+		want    string
+		notWant string
+	}{
+		{name: "saved", summary: saved, want: "Checkpoint saved to /tmp/cp.json"},
+		{name: "not saved", summary: failed, want: "Checkpoint could not be saved to /tmp/cp.json: permission denied", notWant: "Checkpoint saved"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printSummary(&out, tc.summary, "/tmp/cp.json")
+			if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("output %q does not contain %q", out.String(), tc.want)
+			}
+			if tc.notWant != "" && strings.Contains(out.String(), tc.notWant) {
+				t.Errorf("output %q contains %q", out.String(), tc.notWant)
+			}
+		})
+	}
+}
+
+func TestPrintDotfilesPlan(t *testing.T) {
+	changes := []installer.DotfileChange{
+		{Path: "/home/u/.zshrc", Action: installer.DotfileUpdate, Old: []byte("a\n"), New: []byte("a\nb\n")},
+		{Path: "/home/u/.tmux.conf", Action: installer.DotfileUnchanged},
+	}
+	cases := []struct {
+		name    string
+		verbose bool
+		err     error
+		want    []string
+		notWant string
+	}{
+		{name: "plain", want: []string{"Dotfiles:", "- /home/u/.zshrc: update (+1 -0)", "- /home/u/.tmux.conf: unchanged"}, notWant: "+b"},
+		{name: "verbose", verbose: true, want: []string{"- /home/u/.zshrc: update (+1 -0)", "Dotfiles diff:", "+b"}},
+		{name: "error", err: errors.New("zellij.kdl: line 3: unexpected }"), want: []string{"- could not preview dotfiles: zellij.kdl: line 3"}, notWant: "update"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printDotfilesPlan(&out, changes, tc.err, tc.verbose)
+			for _, w := range tc.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("output %q does not contain %q", out.String(), w)
+				}
+			}
+			if tc.notWant != "" && strings.Contains(out.String(), tc.notWant) {
+				t.Errorf("output %q contains %q", out.String(), tc.notWant)
+			}
+		})
+	}
+}
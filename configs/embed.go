@@ -4,5 +4,5 @@ import "embed"
 
 // FS provides embedded configuration templates and files.
 //
-//go:embed *.tmpl *.toml *.conf *.kdl
+//go:embed *.tmpl *.toml *.conf *.kdl *.json
 var FS embed.FS
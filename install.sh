@@ -10,17 +10,25 @@ echo -e "${BLUE}macsetup${NC}"
 echo "Team Mac Onboarding Tool"
 echo ""
 
-if [[ "$(uname)" != "Darwin" ]]; then
-  echo -e "${RED}Error: This script only works on macOS${NC}"
-  exit 1
-fi
+case "$(uname)" in
+  Darwin) OS="darwin" ;;
+  Linux) OS="linux" ;;
+  *)
+    echo -e "${RED}Error: This script only works on macOS and Linux${NC}"
+    exit 1
+    ;;
+esac
 
-if [[ "$(uname -m)" != "arm64" ]]; then
-  echo -e "${RED}Error: This script only supports Apple Silicon Macs (arm64)${NC}"
-  exit 1
-fi
+case "$(uname -m)" in
+  arm64|aarch64) ARCH="arm64" ;;
+  x86_64) ARCH="amd64" ;;
+  *)
+    echo -e "${RED}Error: Unsupported architecture: $(uname -m)${NC}"
+    exit 1
+    ;;
+esac
 
-echo -e "${GREEN}✓${NC} macOS on Apple Silicon detected"
+echo -e "${GREEN}✓${NC} ${OS}/${ARCH} detected"
 
 REPO="Dinesh7N/mac-setup"
 
@@ -35,7 +43,7 @@ else
   echo "Using specified version: ${VERSION}"
 fi
 
-URL="https://github.com/${REPO}/releases/download/${VERSION}/macsetup-darwin-arm64"
+URL="https://github.com/${REPO}/releases/download/${VERSION}/macsetup-${OS}-${ARCH}"
 BINARY="/tmp/macsetup"
 
 echo "Downloading macsetup ${VERSION}..."
@@ -46,7 +54,9 @@ fi
 chmod +x "$BINARY"
 
 # Remove quarantine attribute to prevent Gatekeeper from blocking execution
-xattr -d com.apple.quarantine "$BINARY" 2>/dev/null || true
+if [[ "${OS}" == "darwin" ]]; then
+  xattr -d com.apple.quarantine "$BINARY" 2>/dev/null || true
+fi
 
 echo -e "${GREEN}✓${NC} Downloaded successfully"
 echo ""
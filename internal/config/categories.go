@@ -22,5 +22,6 @@ func Categories() []Category {
 		{Key: "devops", Name: "DevOps", Description: "Infrastructure and DevOps tools", Required: false, Selectable: true},
 		{Key: "ai", Name: "AI Tools", Description: "AI assistants and tools", Required: false, Selectable: true},
 		{Key: "optional", Name: "Optional Apps", Description: "Optional applications", Required: false, Selectable: true},
+		{Key: "dotfiles", Name: "Dotfiles", Description: "Configs macsetup writes, one per tool", Required: false, Selectable: true},
 	}
 }
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DotfilesMode decides how macsetup writes the configs it manages.
+type DotfilesMode string
+
+const (
+	// DotfilesMerge keeps the user's files and only owns a delimited block in
+	// each (or an import of a macsetup file, for formats where a block is not
+	// safe).
+	DotfilesMerge DotfilesMode = "merge"
+	// DotfilesReplace overwrites each file with the team version, keeping a
+	// backup of the old one.
+	DotfilesReplace DotfilesMode = "replace"
+	// DotfilesLink symlinks each file that is not a template to the team
+	// version, so edits made in place land in the source. Templates are
+	// still rendered and merged as in DotfilesMerge.
+	DotfilesLink DotfilesMode = "link"
+)
+
+func ParseDotfilesMode(s string) (DotfilesMode, error) {
+	switch m := DotfilesMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case DotfilesMerge, DotfilesReplace, DotfilesLink:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown dotfiles mode %q (want merge, replace or link)", s)
+	}
+}
+
+// Dotfiles configures how the dotfiles step writes configs.
+type Dotfiles struct {
+	Mode DotfilesMode `json:"mode,omitempty"`
+	// Source replaces the configs built into macsetup: a local directory, or
+	// a git repository URL with an optional ref. Either way it has a
+	// DotfilesManifestName at its root.
+	Source Asset `json:"source,omitempty"`
+	// Files names the files to write (see DotfileSpec.Name). Nil means all of
+	// them, an empty list none.
+	Files []string `json:"files,omitempty"`
+
+	// Values for the templates. Unset ones are detected (the user from git,
+	// the terminal from the selected and installed packages) or defaulted.
+	User     DotfilesUser      `json:"user,omitempty"`
+	Terminal string            `json:"terminal,omitempty"`
+	Theme    string            `json:"theme,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+}
+
+// DotfilesUser is who the configs are written for.
+type DotfilesUser struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// DotfilesManifestName is the mapping file at the root of a dotfiles source.
+const DotfilesManifestName = "dotfiles.json"
+
+// MergeStyle is how a dotfile is combined with the user's file in
+// DotfilesMerge mode.
+type MergeStyle string
+
+const (
+	// MergeBlock owns a managed block inside the file.
+	MergeBlock MergeStyle = "block"
+	// MergeImport writes the team config to a file of its own (Managed) and
+	// owns a block in the user's file that imports it. Used for TOML, where a
+	// block appended to the file would land in whatever table comes last.
+	MergeImport MergeStyle = "import"
+	// MergeOwn replaces the whole file, for tools that read a single file and
+	// have no include mechanism.
+	MergeOwn MergeStyle = "own"
+)
+
+// DotfileFormat is the syntax a dotfile is checked against before macsetup
+// writes it.
+type DotfileFormat string
+
+const (
+	FormatTOML DotfileFormat = "toml"
+	FormatKDL  DotfileFormat = "kdl"
+	// FormatZsh is checked with zsh -n, and FormatTmux by having tmux parse
+	// the file; both are skipped where the tool is not installed.
+	FormatZsh  DotfileFormat = "zsh"
+	FormatTmux DotfileFormat = "tmux"
+	// FormatNone turns the check off.
+	FormatNone DotfileFormat = "none"
+)
+
+// DotfileSpec maps one file of a dotfiles source to where it is installed.
+// Paths in Dest, Managed and Local start with ~/ or are absolute paths under
+// the home directory: a dotfiles source never writes outside it.
+type DotfileSpec struct {
+	// Name picks the file in Dotfiles.Files and --dotfiles; it defaults to
+	// Src up to the first dot.
+	Name string `json:"name,omitempty"`
+	Src  string `json:"src"`
+	Dest string `json:"dest"`
+	// Template renders Src with Go templates; a Src ending in .tmpl is
+	// always one. Other files are taken as they are, and link mode can
+	// symlink them.
+	Template bool       `json:"template,omitempty"`
+	Mode     MergeStyle `json:"mode,omitempty"` // default MergeBlock
+	// Comment is the format's line comment, used for block markers.
+	Comment string `json:"comment,omitempty"`
+	// Managed and Table are for MergeImport: the file the team config is
+	// written to, and the TOML table the import key belongs in.
+	Managed string `json:"managed,omitempty"`
+	Table   string `json:"table,omitempty"`
+	// Local is a file of the user's own that the config includes, for
+	// per-machine tweaks. It is created empty if missing and never written
+	// or compared again.
+	Local string `json:"local,omitempty"`
+	// Format defaults to the extension of Dest when it is .toml or .kdl, and
+	// to FormatNone otherwise.
+	Format DotfileFormat `json:"format,omitempty"`
+}
+
+// DotfileLink is a symlink created at Path pointing to Target.
+type DotfileLink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// DotfilesManifest declares the files a dotfiles source provides.
+type DotfilesManifest struct {
+	Files []DotfileSpec `json:"files"`
+	Links []DotfileLink `json:"links,omitempty"`
+}
+
+// ParseDotfilesManifest reads and checks a DotfilesManifestName file.
+func ParseDotfilesManifest(data []byte) (DotfilesManifest, error) {
+	var m DotfilesManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("invalid %s: %w", DotfilesManifestName, err)
+	}
+	if len(m.Files) == 0 {
+		return m, fmt.Errorf("%s lists no files", DotfilesManifestName)
+	}
+	names := make(map[string]bool)
+	for i := range m.Files {
+		f := &m.Files[i]
+		if f.Mode == "" {
+			f.Mode = MergeBlock
+		}
+		if strings.HasSuffix(f.Src, ".tmpl") {
+			f.Template = true
+		}
+		if f.Name == "" {
+			f.Name, _, _ = strings.Cut(filepath.Base(f.Src), ".")
+		}
+		if f.Format == "" {
+			switch filepath.Ext(f.Dest) {
+			case ".toml":
+				f.Format = FormatTOML
+			case ".kdl":
+				f.Format = FormatKDL
+			default:
+				f.Format = FormatNone
+			}
+		}
+		switch {
+		case f.Src == "":
+			return m, fmt.Errorf("%s: file %d has no src", DotfilesManifestName, i+1)
+		case names[f.Name]:
+			return m, fmt.Errorf("%s: %s: name %q is used twice", DotfilesManifestName, f.Src, f.Name)
+		case !inHome(f.Dest):
+			return m, fmt.Errorf("%s: %s: dest %q must be in the home directory (~/...)", DotfilesManifestName, f.Src, f.Dest)
+		case f.Mode != MergeBlock && f.Mode != MergeImport && f.Mode != MergeOwn:
+			return m, fmt.Errorf("%s: %s: unknown mode %q (want block, import or own)", DotfilesManifestName, f.Src, f.Mode)
+		case f.Mode != MergeOwn && f.Comment == "":
+			return m, fmt.Errorf("%s: %s: mode %s needs a comment", DotfilesManifestName, f.Src, f.Mode)
+		case f.Mode == MergeImport && (f.Managed == "" || f.Table == ""):
+			return m, fmt.Errorf("%s: %s: mode import needs managed and table", DotfilesManifestName, f.Src)
+		case f.Managed != "" && !inHome(f.Managed):
+			return m, fmt.Errorf("%s: %s: managed %q must be in the home directory (~/...)", DotfilesManifestName, f.Src, f.Managed)
+		case f.Local != "" && !inHome(f.Local):
+			return m, fmt.Errorf("%s: %s: local %q must be in the home directory (~/...)", DotfilesManifestName, f.Src, f.Local)
+		case f.Format != FormatTOML && f.Format != FormatKDL && f.Format != FormatZsh && f.Format != FormatTmux && f.Format != FormatNone:
+			return m, fmt.Errorf("%s: %s: unknown format %q (want toml, kdl, zsh, tmux or none)", DotfilesManifestName, f.Src, f.Format)
+		}
+		names[f.Name] = true
+	}
+	for _, l := range m.Links {
+		if !inHome(l.Path) || !inHome(l.Target) {
+			return m, fmt.Errorf("%s: link %q -> %q: paths must be in the home directory (~/...)", DotfilesManifestName, l.Path, l.Target)
+		}
+	}
+	return m, nil
+}
+
+// inHome reports whether a manifest path stays inside the home directory:
+// ~/ followed by a path that does not climb out of it, or an absolute path
+// under $HOME.
+func inHome(path string) bool {
+	rel, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil || !filepath.IsAbs(path) {
+			return false
+		}
+		if rel, err = filepath.Rel(home, path); err != nil {
+			return false
+		}
+	}
+	rel = filepath.Clean(rel)
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") && !filepath.IsAbs(rel)
+}
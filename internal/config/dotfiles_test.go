@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"macsetup/configs"
+)
+
+func TestParseDotfilesManifest(t *testing.T) {
+	data, err := configs.FS.ReadFile(DotfilesManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseDotfilesManifest(data)
+	if err != nil {
+		t.Fatalf("embedded manifest: %v", err)
+	}
+	for _, f := range m.Files {
+		if _, err := configs.FS.Open(f.Src); err != nil {
+			t.Fatalf("embedded manifest lists missing %s", f.Src)
+		}
+	}
+
+	cases := []struct {
+		name, data, want string
+	}{
+		{"no files", `{"files": []}`, "lists no files"},
+		{"relative dest", `{"files": [{"src": "a", "dest": "a", "comment": "#"}]}`, "must be in the home directory"},
+		{"dest outside home", `{"files": [{"src": "a", "dest": "/etc/zshrc", "comment": "#"}]}`, "must be in the home directory"},
+		{"dest climbing out of home", `{"files": [{"src": "a", "dest": "~/../../etc/zshrc", "comment": "#"}]}`, "must be in the home directory"},
+		{"managed outside home", `{"files": [{"src": "a", "dest": "~/a", "mode": "import", "comment": "#", "managed": "/tmp/b", "table": "t"}]}`, "managed \"/tmp/b\" must be in the home directory"},
+		{"local outside home", `{"files": [{"src": "a", "dest": "~/a", "mode": "own", "local": "/etc/local"}]}`, "local \"/etc/local\" must be in the home directory"},
+		{"unknown mode", `{"files": [{"src": "a", "dest": "~/a", "mode": "append"}]}`, "unknown mode"},
+		{"block without comment", `{"files": [{"src": "a", "dest": "~/a"}]}`, "needs a comment"},
+		{"import without table", `{"files": [{"src": "a", "dest": "~/a", "mode": "import", "comment": "#", "managed": "~/b"}]}`, "needs managed and table"},
+		{"unknown format", `{"files": [{"src": "a", "dest": "~/a", "mode": "own", "format": "yaml"}]}`, "unknown format"},
+		{"relative link", `{"files": [{"src": "a", "dest": "~/a", "mode": "own"}], "links": [{"path": "a", "target": "~/a"}]}`, "paths must be in the home directory"},
+		{"link target outside home", `{"files": [{"src": "a", "dest": "~/a", "mode": "own"}], "links": [{"path": "~/a", "target": "/etc/passwd"}]}`, "paths must be in the home directory"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseDotfilesManifest([]byte(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestInHome(t *testing.T) {
+	t.Setenv("HOME", "/home/u")
+	for path, want := range map[string]bool{
+		"~/.zshrc":               true,
+		"~/.config/../.zshrc":    true,
+		"/home/u/.config/a.toml": true,
+		"~/":                     false,
+		"~/..":                   false,
+		"~/../v/.zshrc":          false,
+		"/home/u":                false,
+		"/home/u/../v/.zshrc":    false,
+		"/home/uv/.zshrc":        false,
+		"/etc/zshrc":             false,
+		".zshrc":                 false,
+		"~user/.zshrc":           false,
+	} {
+		if got := inHome(path); got != want {
+			t.Errorf("inHome(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+)
+
 type PackageType string
 
 const (
@@ -10,6 +15,27 @@ const (
 	TypeTask    PackageType = "task"
 )
 
+// AdoptPolicy decides what happens when a cask's app already exists outside Homebrew.
+type AdoptPolicy string
+
+const (
+	// AdoptSkip leaves the existing app alone and unmanaged.
+	AdoptSkip AdoptPolicy = "skip"
+	// AdoptAdopt hands the existing app over to Homebrew (brew install --cask --adopt).
+	AdoptAdopt AdoptPolicy = "adopt"
+	// AdoptReplace reinstalls the app from the cask over the existing bundle.
+	AdoptReplace AdoptPolicy = "replace"
+)
+
+func ParseAdoptPolicy(s string) (AdoptPolicy, error) {
+	switch p := AdoptPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case AdoptSkip, AdoptAdopt, AdoptReplace:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown adoption policy %q (want skip, adopt or replace)", s)
+	}
+}
+
 type Package struct {
 	Name        string
 	Type        PackageType
@@ -19,6 +45,13 @@ type Package struct {
 	Default     bool
 	Description string
 	Tap         string
+	// AppName is the bundle a cask installs into /Applications, set for
+	// every cask that installs an app. Brew's app artifacts come first; this
+	// is what is looked for when brew cannot be asked (not installed yet,
+	// offline, a dry run) or its artifacts name the wrong bundle.
+	AppName string
+	// Adopt overrides the run's adoption policy for this cask.
+	Adopt AdoptPolicy
 }
 
 func AllPackages() []Package {
@@ -45,31 +78,31 @@ func AllPackages() []Package {
 		{Name: "zellij", Type: TypeFormula, Category: "shell_cli", Required: true, Default: true, Description: "Pluggable terminal workspace, with terminal multiplexer as the base feature"},
 
 		// Terminals
-		{Name: "iterm2", Type: TypeCask, Category: "terminals", Default: true, Description: "Terminal emulator as alternative to Apple's Terminal app"},
-		{Name: "ghostty", Type: TypeCask, Category: "terminals", Default: false, Description: "Terminal emulator that uses platform-native UI and GPU acceleration"},
+		{Name: "iterm2", Type: TypeCask, Category: "terminals", Default: true, Description: "Terminal emulator as alternative to Apple's Terminal app", AppName: "iTerm.app"},
+		{Name: "ghostty", Type: TypeCask, Category: "terminals", Default: false, Description: "Terminal emulator that uses platform-native UI and GPU acceleration", AppName: "Ghostty.app"},
 
 		// Editors
-		{Name: "visual-studio-code", Type: TypeCask, Category: "editors", Default: false, Description: "Open-source code editor"},
-		{Name: "zed", Type: TypeCask, Category: "editors", Default: false, Description: "Multiplayer code editor"},
-		{Name: "sublime-text", Type: TypeCask, Category: "editors", Default: false, Description: "Text editor for code, markup and prose"},
-		{Name: "jetbrains-toolbox", Type: TypeCask, Category: "editors", Default: false, Description: "JetBrains tools manager"},
+		{Name: "visual-studio-code", Type: TypeCask, Category: "editors", Default: false, Description: "Open-source code editor", AppName: "Visual Studio Code.app"},
+		{Name: "zed", Type: TypeCask, Category: "editors", Default: false, Description: "Multiplayer code editor", AppName: "Zed.app"},
+		{Name: "sublime-text", Type: TypeCask, Category: "editors", Default: false, Description: "Text editor for code, markup and prose", AppName: "Sublime Text.app"},
+		{Name: "jetbrains-toolbox", Type: TypeCask, Category: "editors", Default: false, Description: "JetBrains tools manager", AppName: "JetBrains Toolbox.app"},
 
 		// Browsers
-		{Name: "brave-browser", Type: TypeCask, Category: "browsers", Default: false, Description: "Web browser focusing on privacy"},
-		{Name: "google-chrome", Type: TypeCask, Category: "browsers", Default: false, Description: "Web browser"},
-		{Name: "firefox", Type: TypeCask, Category: "browsers", Default: false, Description: "Web browser"},
+		{Name: "brave-browser", Type: TypeCask, Category: "browsers", Default: false, Description: "Web browser focusing on privacy", AppName: "Brave Browser.app"},
+		{Name: "google-chrome", Type: TypeCask, Category: "browsers", Default: false, Description: "Web browser", AppName: "Google Chrome.app"},
+		{Name: "firefox", Type: TypeCask, Category: "browsers", Default: false, Description: "Web browser", AppName: "Firefox.app"},
 
 		// Productivity
-		{Name: "raycast", Type: TypeCask, Category: "productivity", Default: true, Description: "Control your tools with a few keystrokes"},
-		{Name: "rectangle", Type: TypeCask, Category: "productivity", Default: true, Description: "Move and resize windows using keyboard shortcuts or snap areas"},
+		{Name: "raycast", Type: TypeCask, Category: "productivity", Default: true, Description: "Control your tools with a few keystrokes", AppName: "Raycast.app"},
+		{Name: "rectangle", Type: TypeCask, Category: "productivity", Default: true, Description: "Move and resize windows using keyboard shortcuts or snap areas", AppName: "Rectangle.app"},
 
 		// Dev env
-		{Name: "orbstack", Type: TypeCask, Category: "dev_env", Default: false, Description: "Replacement for Docker Desktop"},
+		{Name: "orbstack", Type: TypeCask, Category: "dev_env", Default: false, Description: "Replacement for Docker Desktop", AppName: "OrbStack.app"},
 		{Name: "postgresql@17", Type: TypeFormula, Category: "dev_env", Default: false, Description: "Object-relational database system"},
 		{Name: "redis", Type: TypeFormula, Category: "dev_env", Default: false, Description: "Persistent key-value database, with built-in net interface"},
-		{Name: "amazon-workspaces", Type: TypeCask, Category: "dev_env", Default: false, Description: "Cloud native persistent desktop virtualization"},
-		{Name: "postman", Type: TypeCask, Category: "dev_env", Default: false, Description: "Collaboration platform for API development"},
-		{Name: "bruno", Type: TypeCask, Category: "dev_env", Default: false, Description: "Open source IDE for exploring and testing APIs"},
+		{Name: "amazon-workspaces", Type: TypeCask, Category: "dev_env", Default: false, Description: "Cloud native persistent desktop virtualization", AppName: "WorkSpaces.app"},
+		{Name: "postman", Type: TypeCask, Category: "dev_env", Default: false, Description: "Collaboration platform for API development", AppName: "Postman.app"},
+		{Name: "bruno", Type: TypeCask, Category: "dev_env", Default: false, Description: "Open source IDE for exploring and testing APIs", AppName: "Bruno.app"},
 
 		// Programming Utilities
 		// General
@@ -112,12 +145,12 @@ func AllPackages() []Package {
 		{Name: "gemini-cli", Type: TypeFormula, Category: "ai", Default: false, Description: "Interact with Google Gemini AI models from the command-line"},
 		{Name: "claude-code", Type: TypeCask, Category: "ai", Default: false, Description: "Terminal-based AI coding assistant"},
 		{Name: "codex", Type: TypeCask, Category: "ai", Default: false, Description: "OpenAI's coding agent that runs in your terminal"},
-		{Name: "chatgpt", Type: TypeCask, Category: "ai", Default: false, Description: "OpenAI's official ChatGPT desktop app"},
-		{Name: "claude", Type: TypeCask, Category: "ai", Default: false, Description: "Anthropic's official Claude AI desktop app"},
+		{Name: "chatgpt", Type: TypeCask, Category: "ai", Default: false, Description: "OpenAI's official ChatGPT desktop app", AppName: "ChatGPT.app"},
+		{Name: "claude", Type: TypeCask, Category: "ai", Default: false, Description: "Anthropic's official Claude AI desktop app", AppName: "Claude.app"},
 
 		// Optional
-		{Name: "1password", Type: TypeCask, Category: "optional", Default: false, Description: "Password manager that keeps all passwords secure behind one password"},
+		{Name: "1password", Type: TypeCask, Category: "optional", Default: false, Description: "Password manager that keeps all passwords secure behind one password", AppName: "1Password.app"},
 		{Name: "1password-cli", Type: TypeCask, Category: "optional", Default: false, Description: "Command-line interface for 1Password"},
-		{Name: "spotify", Type: TypeCask, Category: "optional", Default: false, Description: "Music streaming service"},
+		{Name: "spotify", Type: TypeCask, Category: "optional", Default: false, Description: "Music streaming service", AppName: "Spotify.app"},
 	}
 }
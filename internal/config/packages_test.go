@@ -1,6 +1,9 @@
 package config
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestAllPackagesHaveCategory(t *testing.T) {
 	categories := make(map[string]bool)
@@ -25,3 +28,45 @@ func TestNoDuplicatePackages(t *testing.T) {
 		seen[key] = true
 	}
 }
+
+func TestParseAdoptPolicy(t *testing.T) {
+	for _, in := range []string{"skip", "adopt", " Replace "} {
+		if _, err := ParseAdoptPolicy(in); err != nil {
+			t.Fatalf("ParseAdoptPolicy(%q): %v", in, err)
+		}
+	}
+	if _, err := ParseAdoptPolicy("overwrite"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestCaskAppNames(t *testing.T) {
+	want := map[string]string{
+		"iterm2":             "iTerm.app",
+		"visual-studio-code": "Visual Studio Code.app",
+		"google-chrome":      "Google Chrome.app",
+		"brave-browser":      "Brave Browser.app",
+		"jetbrains-toolbox":  "JetBrains Toolbox.app",
+		"orbstack":           "OrbStack.app",
+		"amazon-workspaces":  "WorkSpaces.app",
+		"1password":          "1Password.app",
+	}
+	// Casks that only install command line tools have no app.
+	cli := map[string]bool{"claude-code": true, "codex": true, "1password-cli": true}
+	for _, pkg := range AllPackages() {
+		if pkg.Type != TypeCask {
+			if pkg.AppName != "" {
+				t.Errorf("%s is not a cask but has AppName %q", pkg.Name, pkg.AppName)
+			}
+			continue
+		}
+		switch {
+		case cli[pkg.Name] && pkg.AppName != "":
+			t.Errorf("%s installs no app but has AppName %q", pkg.Name, pkg.AppName)
+		case !cli[pkg.Name] && !strings.HasSuffix(pkg.AppName, ".app"):
+			t.Errorf("%s: AppName %q is not an app bundle", pkg.Name, pkg.AppName)
+		case want[pkg.Name] != "" && pkg.AppName != want[pkg.Name]:
+			t.Errorf("%s: AppName %q, want %q", pkg.Name, pkg.AppName, want[pkg.Name])
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"macsetup/internal/constants"
+)
+
+// Settings is the user configuration read from ~/.config/macsetup/config.json.
+// Every field is optional; missing values fall back to DefaultSettings.
+type Settings struct {
+	Sources  Sources  `json:"sources"`
+	Network  Network  `json:"network"`
+	Timeouts Timeouts `json:"timeouts"`
+	Dotfiles Dotfiles `json:"dotfiles"`
+}
+
+// Sources lists every remote location macsetup downloads from.
+type Sources struct {
+	HomebrewInstallScript Asset            `json:"homebrew_install_script"`
+	OhMyZshInstallScript  Asset            `json:"ohmyzsh_install_script"`
+	KickstartNvim         Asset            `json:"kickstart_nvim"`
+	TPM                   Asset            `json:"tpm"`
+	ZshPlugins            map[string]Asset `json:"zsh_plugins,omitempty"`
+	// HomebrewRepo and OhMyZshRepo are cloned by the install scripts; they
+	// are only fetched directly when building an offline bundle.
+	HomebrewRepo Asset `json:"homebrew_repo"`
+	OhMyZshRepo  Asset `json:"ohmyzsh_repo"`
+}
+
+// Asset is a remote source with optional pins. Scripts can pin a SHA-256
+// digest of their content, git repositories a tag, branch or commit to check
+// out. In JSON an asset is either a plain URL or an object; an object without
+// "url" pins the default URL.
+type Asset struct {
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+}
+
+func (a *Asset) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		a.URL = url
+		return nil
+	}
+	type plain Asset
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// Network holds settings for restricted networks. They are exported to the
+// environment so every spawned command (curl, git, brew, mise) sees them.
+type Network struct {
+	// Mirrors rewrites URL prefixes of every remote source, e.g.
+	// {"https://raw.githubusercontent.com/": "https://mirror.corp/raw/"}.
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+
+	HTTPProxy  string `json:"http_proxy,omitempty"`
+	HTTPSProxy string `json:"https_proxy,omitempty"`
+	NoProxy    string `json:"no_proxy,omitempty"`
+
+	BottleDomain  string `json:"homebrew_bottle_domain,omitempty"`
+	APIDomain     string `json:"homebrew_api_domain,omitempty"`
+	BrewGitRemote string `json:"homebrew_brew_git_remote,omitempty"`
+	CoreGitRemote string `json:"homebrew_core_git_remote,omitempty"`
+
+	// GitInsteadOf maps a replacement base URL to the prefix it stands in for,
+	// as in git's url.<base>.insteadOf.
+	GitInsteadOf map[string]string `json:"git_insteadof,omitempty"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{Sources: DefaultSources(), Timeouts: DefaultTimeouts()}
+}
+
+func DefaultSources() Sources {
+	return Sources{
+		HomebrewInstallScript: Asset{URL: constants.HomebrewInstallScriptURL},
+		OhMyZshInstallScript:  Asset{URL: constants.OhMyZshInstallURL},
+		KickstartNvim:         Asset{URL: constants.KickstartNvimURL},
+		TPM:                   Asset{URL: constants.TpmURL},
+		ZshPlugins: map[string]Asset{
+			"zsh-autosuggestions":     {URL: constants.ZshAutosuggestionsURL},
+			"zsh-autocomplete":        {URL: constants.ZshAutocompleteURL},
+			"zsh-syntax-highlighting": {URL: constants.ZshSyntaxHighlightingURL},
+			"zsh-completions":         {URL: constants.ZshCompletionsURL},
+		},
+		HomebrewRepo: Asset{URL: constants.HomebrewRepoURL},
+		OhMyZshRepo:  Asset{URL: constants.OhMyZshRepoURL},
+	}
+}
+
+// DefaultSettingsPath returns ~/.config/macsetup/config.json.
+func DefaultSettingsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, constants.SettingsPath), nil
+}
+
+// LoadSettings reads path on top of DefaultSettings. A missing file is only an
+// error when required is set (i.e. the path was given explicitly).
+func LoadSettings(path string, required bool) (Settings, error) {
+	settings := DefaultSettings()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			return settings, nil
+		}
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// WithDefaults fills empty source URLs from DefaultSources, keeping any pins.
+func (s Sources) WithDefaults() Sources {
+	d := DefaultSources()
+	fill := func(a *Asset, def Asset) {
+		if a.URL == "" {
+			a.URL = def.URL
+		}
+	}
+	fill(&s.HomebrewInstallScript, d.HomebrewInstallScript)
+	fill(&s.OhMyZshInstallScript, d.OhMyZshInstallScript)
+	fill(&s.KickstartNvim, d.KickstartNvim)
+	fill(&s.TPM, d.TPM)
+	fill(&s.HomebrewRepo, d.HomebrewRepo)
+	fill(&s.OhMyZshRepo, d.OhMyZshRepo)
+	if len(s.ZshPlugins) == 0 {
+		s.ZshPlugins = d.ZshPlugins
+		return s
+	}
+	plugins := make(map[string]Asset, len(s.ZshPlugins))
+	for name, a := range s.ZshPlugins {
+		fill(&a, d.ZshPlugins[name])
+		plugins[name] = a
+	}
+	s.ZshPlugins = plugins
+	return s
+}
+
+// ResolvedSources returns the sources with defaults filled in and mirrors applied.
+func (s Settings) ResolvedSources() Sources {
+	src := s.Sources.WithDefaults()
+	n := s.Network
+	plugins := make(map[string]Asset, len(src.ZshPlugins))
+	for name, a := range src.ZshPlugins {
+		plugins[name] = n.RewriteAsset(a)
+	}
+	return Sources{
+		HomebrewInstallScript: n.RewriteAsset(src.HomebrewInstallScript),
+		OhMyZshInstallScript:  n.RewriteAsset(src.OhMyZshInstallScript),
+		KickstartNvim:         n.RewriteAsset(src.KickstartNvim),
+		TPM:                   n.RewriteAsset(src.TPM),
+		ZshPlugins:            plugins,
+		HomebrewRepo:          n.RewriteAsset(src.HomebrewRepo),
+		OhMyZshRepo:           n.RewriteAsset(src.OhMyZshRepo),
+	}
+}
+
+// RewriteAsset applies Rewrite to an asset's URL; pins are kept since a
+// mirror serves the same content.
+func (n Network) RewriteAsset(a Asset) Asset {
+	a.URL = n.Rewrite(a.URL)
+	return a
+}
+
+// Rewrite applies the longest matching mirror prefix to url.
+func (n Network) Rewrite(url string) string {
+	best := ""
+	for prefix := range n.Mirrors {
+		if strings.HasPrefix(url, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return url
+	}
+	return n.Mirrors[best] + strings.TrimPrefix(url, best)
+}
+
+// Env returns the environment variables (KEY=VALUE) that carry these settings
+// to child processes. Proxies are set in both cases since curl only reads the
+// lowercase http_proxy.
+func (n Network) Env() []string {
+	var env []string
+	add := func(value string, keys ...string) {
+		if value == "" {
+			return
+		}
+		for _, k := range keys {
+			env = append(env, k+"="+value)
+		}
+	}
+	add(n.HTTPProxy, "HTTP_PROXY", "http_proxy")
+	add(n.HTTPSProxy, "HTTPS_PROXY", "https_proxy")
+	add(n.NoProxy, "NO_PROXY", "no_proxy")
+	add(n.BottleDomain, "HOMEBREW_BOTTLE_DOMAIN")
+	add(n.APIDomain, "HOMEBREW_API_DOMAIN")
+	add(n.BrewGitRemote, "HOMEBREW_BREW_GIT_REMOTE")
+	add(n.CoreGitRemote, "HOMEBREW_CORE_GIT_REMOTE")
+
+	if len(n.GitInsteadOf) > 0 {
+		bases := make([]string, 0, len(n.GitInsteadOf))
+		for base := range n.GitInsteadOf {
+			bases = append(bases, base)
+		}
+		sort.Strings(bases)
+		// GIT_CONFIG_COUNT/KEY/VALUE inject config into every git invocation,
+		// including the ones brew and the install scripts run.
+		env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(bases)))
+		for i, base := range bases {
+			env = append(env,
+				fmt.Sprintf("GIT_CONFIG_KEY_%d=url.%s.insteadOf", i, base),
+				fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, n.GitInsteadOf[base]),
+			)
+		}
+	}
+	return env
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"macsetup/internal/constants"
+)
+
+func TestLoadSettingsMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	s, err := LoadSettings(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, DefaultSettings()) {
+		t.Fatalf("expected defaults, got %+v", s)
+	}
+	if _, err := LoadSettings(path, true); err == nil {
+		t.Fatalf("expected error for missing explicit config")
+	}
+}
+
+func TestLoadSettingsMergesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "sources": {"tpm": "https://git.corp/tmux/tpm.git", "zsh_plugins": {"zsh-vi-mode": "https://github.com/jeffreytse/zsh-vi-mode.git"}},
+  "network": {
+    "mirrors": {
+      "https://raw.githubusercontent.com/": "https://mirror.corp/raw/",
+      "https://github.com/": "https://mirror.corp/github/"
+    },
+    "https_proxy": "http://proxy.corp:3128",
+    "homebrew_bottle_domain": "https://mirror.corp/bottles"
+  }
+}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSettings(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := s.ResolvedSources()
+	if src.TPM.URL != "https://git.corp/tmux/tpm.git" {
+		t.Fatalf("tpm: got %q", src.TPM.URL)
+	}
+	if src.HomebrewInstallScript.URL != "https://mirror.corp/raw/Homebrew/install/HEAD/install.sh" {
+		t.Fatalf("homebrew script: got %q", src.HomebrewInstallScript.URL)
+	}
+	if src.KickstartNvim.URL != "https://mirror.corp/github/nvim-lua/kickstart.nvim.git" {
+		t.Fatalf("kickstart: got %q", src.KickstartNvim.URL)
+	}
+	if len(src.ZshPlugins) != 5 {
+		t.Fatalf("expected default plugins plus one, got %d", len(src.ZshPlugins))
+	}
+	if got := src.ZshPlugins["zsh-completions"].URL; got != "https://mirror.corp/github/zsh-users/zsh-completions.git" {
+		t.Fatalf("plugin mirror: got %q", got)
+	}
+	if s.Sources.OhMyZshInstallScript.URL != constants.OhMyZshInstallURL {
+		t.Fatalf("default lost: %q", s.Sources.OhMyZshInstallScript.URL)
+	}
+}
+
+func TestAssetPins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "sources": {
+    "homebrew_install_script": {"sha256": "abc123"},
+    "tpm": {"url": "https://github.com/tmux-plugins/tpm.git", "ref": "v3.1.0"},
+    "zsh_plugins": {"zsh-completions": {"ref": "0.35.0"}}
+  },
+  "network": {"mirrors": {"https://github.com/": "https://mirror.corp/github/"}}
+}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSettings(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := s.ResolvedSources()
+
+	want := Asset{URL: constants.HomebrewInstallScriptURL, SHA256: "abc123"}
+	if src.HomebrewInstallScript != want {
+		t.Fatalf("pin without url: got %+v want %+v", src.HomebrewInstallScript, want)
+	}
+	want = Asset{URL: "https://mirror.corp/github/tmux-plugins/tpm.git", Ref: "v3.1.0"}
+	if src.TPM != want {
+		t.Fatalf("tpm: got %+v want %+v", src.TPM, want)
+	}
+	want = Asset{URL: "https://mirror.corp/github/zsh-users/zsh-completions.git", Ref: "0.35.0"}
+	if got := src.ZshPlugins["zsh-completions"]; got != want {
+		t.Fatalf("plugin: got %+v want %+v", got, want)
+	}
+}
+
+func TestNetworkEnv(t *testing.T) {
+	n := Network{
+		HTTPSProxy:   "http://proxy:3128",
+		APIDomain:    "https://mirror/api",
+		GitInsteadOf: map[string]string{"https://git.corp/github/": "https://github.com/"},
+	}
+	want := []string{
+		"HTTPS_PROXY=http://proxy:3128",
+		"https_proxy=http://proxy:3128",
+		"HOMEBREW_API_DOMAIN=https://mirror/api",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=url.https://git.corp/github/.insteadOf",
+		"GIT_CONFIG_VALUE_0=https://github.com/",
+	}
+	if got := n.Env(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env:\n got %q\nwant %q", got, want)
+	}
+	if env := (Network{}).Env(); len(env) != 0 {
+		t.Fatalf("expected empty env, got %q", env)
+	}
+}
+
+func TestLoadSettingsTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"timeouts": {"default": {"stall": "2m"}, "steps": {"formula": {"timeout": "3h", "retries": 2}}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSettings(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		kind StepKind
+		want TimeoutPolicy
+	}{
+		{kind: StepFormula, want: TimeoutPolicy{Timeout: Duration(3 * time.Hour), Stall: Duration(2 * time.Minute), Retries: 2}},
+		{kind: StepGit, want: TimeoutPolicy{Timeout: Duration(15 * time.Minute), Stall: Duration(5 * time.Minute), Retries: 1}},
+		{kind: StepMise, want: TimeoutPolicy{Stall: Duration(2 * time.Minute)}},
+	}
+	for _, tc := range cases {
+		if got := s.Timeouts.For(tc.kind); got != tc.want {
+			t.Fatalf("%s: got %+v want %+v", tc.kind, got, tc.want)
+		}
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"timeouts": {"default": {"stall": 600}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSettings(bad, true); err == nil {
+		t.Fatalf("expected error for numeric duration")
+	}
+}
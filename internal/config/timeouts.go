@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StepKind groups steps that share a timeout policy.
+type StepKind string
+
+const (
+	StepFormula    StepKind = "formula"
+	StepCask       StepKind = "cask"
+	StepTap        StepKind = "tap"
+	StepBrewUpdate StepKind = "brew-update"
+	StepGit        StepKind = "git"
+	StepScript     StepKind = "script"
+	StepMise       StepKind = "mise"
+	StepTask       StepKind = "task"
+)
+
+// Duration is a time.Duration that reads from JSON as a string such as "15m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// TimeoutPolicy bounds the commands of one step. Timeout caps a single
+// command, Stall cancels a command that prints nothing for that long, and
+// Retries is how many more attempts a timed-out or stalled command gets.
+// Zero disables each.
+type TimeoutPolicy struct {
+	Timeout Duration `json:"timeout,omitempty"`
+	Stall   Duration `json:"stall,omitempty"`
+	Retries int      `json:"retries,omitempty"`
+}
+
+// Timeouts holds a policy per step kind; unset fields fall back to Default.
+type Timeouts struct {
+	Default TimeoutPolicy              `json:"default"`
+	Steps   map[StepKind]TimeoutPolicy `json:"steps,omitempty"`
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Default: TimeoutPolicy{Stall: Duration(10 * time.Minute)},
+		Steps: map[StepKind]TimeoutPolicy{
+			// Big bottles and casks download silently when brew has no TTY.
+			StepFormula: {Timeout: Duration(time.Hour), Stall: Duration(20 * time.Minute)},
+			StepCask:    {Timeout: Duration(time.Hour), Stall: Duration(20 * time.Minute)},
+			StepGit:     {Timeout: Duration(15 * time.Minute), Stall: Duration(5 * time.Minute), Retries: 1},
+			StepTap:     {Timeout: Duration(15 * time.Minute), Stall: Duration(5 * time.Minute), Retries: 1},
+		},
+	}
+}
+
+// IsZero reports whether no policy is configured at all.
+func (t Timeouts) IsZero() bool {
+	return t.Default == (TimeoutPolicy{}) && len(t.Steps) == 0
+}
+
+// For returns the policy for kind with unset fields taken from Default.
+func (t Timeouts) For(kind StepKind) TimeoutPolicy {
+	p := t.Steps[kind]
+	if p.Timeout == 0 {
+		p.Timeout = t.Default.Timeout
+	}
+	if p.Stall == 0 {
+		p.Stall = t.Default.Stall
+	}
+	if p.Retries == 0 {
+		p.Retries = t.Default.Retries
+	}
+	return p
+}
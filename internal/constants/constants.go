@@ -6,4 +6,30 @@ const (
 
 	KickstartNvimURL = "https://github.com/nvim-lua/kickstart.nvim.git"
 	TpmURL           = "https://github.com/tmux-plugins/tpm"
+
+	// Repositories the install scripts clone; mirrored into offline bundles.
+	HomebrewRepoURL = "https://github.com/Homebrew/brew"
+	OhMyZshRepoURL  = "https://github.com/ohmyzsh/ohmyzsh.git"
+
+	ZshAutosuggestionsURL    = "https://github.com/zsh-users/zsh-autosuggestions.git"
+	ZshAutocompleteURL       = "https://github.com/marlonrichert/zsh-autocomplete.git"
+	ZshSyntaxHighlightingURL = "https://github.com/zsh-users/zsh-syntax-highlighting.git"
+	ZshCompletionsURL        = "https://github.com/zsh-users/zsh-completions.git"
+
+	// SettingsPath is the default location of the user config, relative to $HOME.
+	SettingsPath = ".config/macsetup/config.json"
+
+	// CheckpointPath records the outcome of the last run, relative to $HOME.
+	CheckpointPath = ".local/state/macsetup/checkpoint.json"
+
+	// BackupIndexPath lists the backups macsetup made of files it rewrote,
+	// relative to $HOME.
+	BackupIndexPath = ".local/state/macsetup/backups.json"
+
+	// LinkedDotfilesDir holds the team configs that link mode symlinks into
+	// place when the source is not a local directory, relative to $HOME.
+	LinkedDotfilesDir = ".local/share/macsetup/dotfiles"
+
+	// DefaultBundleDir is where `bundle create` writes and `--offline` reads.
+	DefaultBundleDir = "macsetup-bundle"
 )
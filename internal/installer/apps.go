@@ -0,0 +1,223 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// CaskApp describes an application bundle found on disk for a cask.
+type CaskApp struct {
+	Path    string
+	Version string
+}
+
+// AppNames returns the .app bundle names the cask installs, taken from its app artifacts.
+func (c BrewCask) AppNames() []string {
+	var names []string
+	for _, raw := range c.Artifacts {
+		var artifact map[string][]json.RawMessage
+		if err := json.Unmarshal(raw, &artifact); err != nil {
+			continue
+		}
+		for _, entry := range artifact["app"] {
+			var name string
+			if err := json.Unmarshal(entry, &name); err == nil {
+				names = append(names, filepath.Base(name))
+				continue
+			}
+			// {"target": "..."} renames the preceding source bundle.
+			var opts struct {
+				Target string `json:"target"`
+			}
+			if err := json.Unmarshal(entry, &opts); err == nil && opts.Target != "" && len(names) > 0 {
+				names[len(names)-1] = filepath.Base(opts.Target)
+			}
+		}
+	}
+	return names
+}
+
+// CaskInfo runs `brew info --json=v2 --cask` for token and returns its entry.
+func CaskInfo(ctx context.Context, verbose bool, token string) (BrewCask, error) {
+	ctx, release := resources.Acquire(ctx, ReadLock(ResBrew))
+	defer release()
+	res, err := utils.Run(ctx, verbose, 10*time.Second, GetBrewExecutable(), "info", "--json=v2", "--cask", token)
+	if err != nil {
+		if strings.TrimSpace(res.Stderr) != "" {
+			return BrewCask{}, fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+		}
+		return BrewCask{}, err
+	}
+	info, err := ParseBrewInfo([]byte(res.Stdout))
+	if err != nil {
+		return BrewCask{}, err
+	}
+	c, ok := info.Cask(token)
+	if !ok {
+		return BrewCask{}, fmt.Errorf("brew info returned no cask named %q", token)
+	}
+	return c, nil
+}
+
+// caskInfos caches CaskInfo for a run, since the same cask is looked up by the
+// prefetch, the install and the adoption checks. Failures are not cached:
+// brew may not be installed yet the first time a cask is asked for.
+type caskInfos struct {
+	mu      sync.Mutex
+	byToken map[string]BrewCask
+}
+
+func newCaskInfos() *caskInfos {
+	return &caskInfos{byToken: make(map[string]BrewCask)}
+}
+
+// get returns CaskInfo for token, asking brew only the first time.
+func (c *caskInfos) get(ctx context.Context, verbose bool, token string) (BrewCask, error) {
+	c.mu.Lock()
+	cask, ok := c.byToken[token]
+	c.mu.Unlock()
+	if ok {
+		return cask, nil
+	}
+	cask, err := CaskInfo(ctx, verbose, token)
+	if err != nil {
+		return BrewCask{}, err
+	}
+	c.mu.Lock()
+	c.byToken[token] = cask
+	c.mu.Unlock()
+	return cask, nil
+}
+
+// appNames returns the bundle names for pkg from brew's cask metadata,
+// followed by the catalog's AppName, which is what is left to look for when
+// brew cannot be asked or its artifacts name the wrong bundle.
+func (c *caskInfos) appNames(ctx context.Context, verbose bool, pkg config.Package) []string {
+	var names []string
+	if cask, err := c.get(ctx, verbose, pkg.Name); err == nil {
+		names = cask.AppNames()
+	}
+	if pkg.AppName != "" && !slices.Contains(names, pkg.AppName) {
+		names = append(names, pkg.AppName)
+	}
+	return names
+}
+
+// findApp checks if a cask's app exists in /Applications or ~/Applications.
+// This detects manually-installed apps that aren't managed by Homebrew.
+func (c *caskInfos) findApp(ctx context.Context, verbose bool, pkg config.Package) (CaskApp, bool) {
+	return findAppBundle(ApplicationDirs(), c.appNames(ctx, verbose, pkg))
+}
+
+// ApplicationDirs lists the directories searched for application bundles.
+func ApplicationDirs() []string {
+	dirs := []string{"/Applications"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Applications"))
+	}
+	return dirs
+}
+
+func findAppBundle(dirs, names []string) (CaskApp, bool) {
+	for _, name := range names {
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				return CaskApp{Path: path, Version: BundleVersion(path)}, true
+			}
+		}
+	}
+	return CaskApp{}, false
+}
+
+// BundleVersion returns CFBundleShortVersionString (or CFBundleVersion) of an
+// application bundle, or "" if it cannot be read.
+func BundleVersion(appPath string) string {
+	plist := filepath.Join(appPath, "Contents", "Info.plist")
+	data, err := os.ReadFile(plist)
+	if err != nil {
+		return ""
+	}
+	if !bytes.HasPrefix(data, []byte("bplist")) {
+		values := plistStrings(data, "CFBundleShortVersionString", "CFBundleVersion")
+		if v := values["CFBundleShortVersionString"]; v != "" {
+			return v
+		}
+		return values["CFBundleVersion"]
+	}
+	// Binary plists need plutil to decode.
+	for _, key := range []string{"CFBundleShortVersionString", "CFBundleVersion"} {
+		res, err := utils.Run(context.Background(), false, 5*time.Second, "plutil", "-extract", key, "raw", "-o", "-", plist)
+		if err == nil && strings.TrimSpace(res.Stdout) != "" {
+			return strings.TrimSpace(res.Stdout)
+		}
+	}
+	return ""
+}
+
+// caskVersionDiffers reports whether an app bundle version is known to differ
+// from a cask version. Casks often append a build after a comma
+// ("4.37.1,178610"), which is ignored.
+func caskVersionDiffers(bundle, cask string) bool {
+	if bundle == "" || cask == "" || cask == "latest" {
+		return false
+	}
+	if i := strings.IndexByte(cask, ','); i >= 0 {
+		cask = cask[:i]
+	}
+	return bundle != cask
+}
+
+// plistStrings extracts top-level string values for keys from an XML property list.
+func plistStrings(data []byte, keys ...string) map[string]string {
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	values := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	depth := 0
+	var element, lastKey string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return values
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			element = t.Name.Local
+		case xml.EndElement:
+			depth--
+			element = ""
+		case xml.CharData:
+			// plist > dict > key/string sits at depth 3.
+			if depth != 3 {
+				continue
+			}
+			text := strings.TrimSpace(string(t))
+			switch element {
+			case "key":
+				lastKey = text
+			case "string":
+				if wanted[lastKey] {
+					values[lastKey] = text
+				}
+				lastKey = ""
+			}
+		}
+	}
+}
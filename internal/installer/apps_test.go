@@ -0,0 +1,175 @@
+package installer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"macsetup/internal/config"
+)
+
+func TestCaskAppNamesFromArtifacts(t *testing.T) {
+	info := loadBrewInfo(t, "brew-info-casks.json")
+	cases := []struct {
+		token string
+		want  []string
+	}{
+		{token: "visual-studio-code", want: []string{"Visual Studio Code.app"}},
+		{token: "1password", want: []string{"1Password.app"}},
+		{token: "jetbrains-toolbox", want: []string{"JetBrains Toolbox.app"}},
+		{token: "zoom", want: []string{"Zoom.app"}},
+		{token: "amazon-workspaces", want: nil},
+		{token: "1password-cli", want: nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.token, func(t *testing.T) {
+			c, ok := info.Cask(tc.token)
+			if !ok {
+				t.Fatalf("cask %q not found", tc.token)
+			}
+			if got := c.AppNames(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("app names: got %q want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+const testInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.microsoft.VSCode</string>
+	<key>CFBundleDocumentTypes</key>
+	<array>
+		<dict>
+			<key>CFBundleShortVersionString</key>
+			<string>nested</string>
+		</dict>
+	</array>
+	<key>LSRequiresNativeExecution</key>
+	<true/>
+	<key>CFBundleShortVersionString</key>
+	<string>1.96.2</string>
+	<key>CFBundleVersion</key>
+	<string>1.96.2.1</string>
+</dict>
+</plist>
+`
+
+func writeTestApp(t *testing.T, dir, name, plist string) string {
+	t.Helper()
+	app := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Join(app, "Contents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if plist != "" {
+		if err := os.WriteFile(filepath.Join(app, "Contents", "Info.plist"), []byte(plist), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return app
+}
+
+func TestFindAppBundleSearchesAllDirs(t *testing.T) {
+	system := t.TempDir()
+	user := t.TempDir()
+	path := writeTestApp(t, user, "Visual Studio Code.app", testInfoPlist)
+
+	app, ok := findAppBundle([]string{system, user}, []string{"Visual Studio Code.app"})
+	if !ok {
+		t.Fatalf("expected app in user dir")
+	}
+	if app.Path != path {
+		t.Fatalf("path: got %q want %q", app.Path, path)
+	}
+	if app.Version != "1.96.2" {
+		t.Fatalf("version: got %q want %q", app.Version, "1.96.2")
+	}
+
+	if _, ok := findAppBundle([]string{system, user}, []string{"Google Chrome.app"}); ok {
+		t.Fatalf("expected missing app")
+	}
+}
+
+func TestBundleVersionWithoutPlist(t *testing.T) {
+	app := writeTestApp(t, t.TempDir(), "Empty.app", "")
+	if got := BundleVersion(app); got != "" {
+		t.Fatalf("version: got %q want empty", got)
+	}
+}
+
+func TestCaskVersionDiffers(t *testing.T) {
+	cases := []struct {
+		bundle, cask string
+		want         bool
+	}{
+		{bundle: "4.37.1", cask: "4.37.1,178610", want: false},
+		{bundle: "4.36.0", cask: "4.37.1,178610", want: true},
+		{bundle: "", cask: "1.0", want: false},
+		{bundle: "1.0", cask: "latest", want: false},
+	}
+	for _, tc := range cases {
+		if got := caskVersionDiffers(tc.bundle, tc.cask); got != tc.want {
+			t.Fatalf("caskVersionDiffers(%q, %q): got %v want %v", tc.bundle, tc.cask, got, tc.want)
+		}
+	}
+}
+
+func TestAdoptPolicyFor(t *testing.T) {
+	opts := RunOptions{
+		Adopt:          config.AdoptAdopt,
+		AdoptOverrides: map[string]config.AdoptPolicy{"zoom": config.AdoptReplace},
+	}
+	cases := []struct {
+		pkg  config.Package
+		want config.AdoptPolicy
+	}{
+		{pkg: config.Package{Name: "zoom"}, want: config.AdoptReplace},
+		{pkg: config.Package{Name: "slack", Adopt: config.AdoptSkip}, want: config.AdoptSkip},
+		{pkg: config.Package{Name: "raycast"}, want: config.AdoptAdopt},
+	}
+	for _, tc := range cases {
+		if got := opts.AdoptPolicyFor(tc.pkg); got != tc.want {
+			t.Fatalf("%s: got %q want %q", tc.pkg.Name, got, tc.want)
+		}
+	}
+	if got := (RunOptions{}).AdoptPolicyFor(config.Package{Name: "x"}); got != config.AdoptSkip {
+		t.Fatalf("default policy: got %q want skip", got)
+	}
+}
+
+func TestCaskInfosAskBrewOnce(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("testdata", "brew-info-casks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\ncat " + fixture + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "brew"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	infos := newCaskInfos()
+	pkg := config.Package{Name: "visual-studio-code", Type: config.TypeCask, AppName: "Visual Studio Code.app"}
+	for range 3 {
+		if got := infos.appNames(context.Background(), false, pkg); !reflect.DeepEqual(got, []string{"Visual Studio Code.app"}) {
+			t.Fatalf("app names: got %q", got)
+		}
+	}
+	if _, err := infos.get(context.Background(), false, "zoom"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Fatalf("brew ran %d times, want once per cask:\n%s", n, data)
+	}
+}
@@ -0,0 +1,262 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"macsetup/internal/constants"
+	"macsetup/internal/utils"
+)
+
+// runID groups the backups made by one invocation of macsetup.
+var runID = time.Now().Format("20060102_150405")
+
+// Backup is one copy of a file that macsetup moved aside before rewriting it,
+// or the old target of a symlink it repointed.
+type Backup struct {
+	Target string `json:"target"`
+	Path   string `json:"path,omitempty"`
+	// OldTarget is set instead of Path for a symlink at Target that was
+	// repointed: where it pointed before.
+	OldTarget string    `json:"old_target,omitempty"`
+	Run       string    `json:"run"`
+	Created   time.Time `json:"created"`
+}
+
+// Stamp is the timestamp utils.WriteWithBackup put in the backup's name,
+// e.g. "20250101_120000.000", or for a symlink when it was repointed.
+func (b Backup) Stamp() string {
+	if b.OldTarget != "" {
+		return b.Created.Local().Format("20060102_150405.000")
+	}
+	rest := strings.TrimPrefix(b.Path, b.Target+".bak.")
+	if i := strings.LastIndex(rest, "."); i > 0 {
+		return rest[:i]
+	}
+	return rest
+}
+
+type backupIndex struct {
+	Backups []Backup `json:"backups"`
+}
+
+func backupIndexPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, constants.BackupIndexPath), nil
+}
+
+// LoadBackups returns every backup in the index, oldest first.
+func LoadBackups() ([]Backup, error) {
+	path, err := backupIndexPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var idx backupIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sort.SliceStable(idx.Backups, func(i, j int) bool { return idx.Backups[i].Created.Before(idx.Backups[j].Created) })
+	return idx.Backups, nil
+}
+
+func saveBackups(backups []Backup) error {
+	path, err := backupIndexPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(backupIndex{Backups: backups}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.EnsureDir(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeWithBackup is utils.WriteWithBackup that also records the backup in
+// the index, so `macsetup backups` can find it.
+func writeWithBackup(dest string, content []byte, mode os.FileMode) (string, error) {
+	backup, err := utils.WriteWithBackup(dest, content, mode)
+	if err != nil || backup == "" {
+		return backup, err
+	}
+	return backup, recordBackup(dest, backup)
+}
+
+// moveToBackup is utils.MoveToBackup that also records the backup in the
+// index.
+func moveToBackup(path string) (string, error) {
+	backup, err := utils.MoveToBackup(path)
+	if err != nil {
+		return "", err
+	}
+	return backup, recordBackup(path, backup)
+}
+
+// Source describes where the backup is kept: the copy's path, or for a
+// symlink its old target.
+func (b Backup) Source() string {
+	if b.OldTarget != "" {
+		return "symlink to " + b.OldTarget
+	}
+	return b.Path
+}
+
+// relink points the symlink at path to target and records where it pointed
+// before, so that RestoreBackup can point it back.
+func relink(path, target string) error {
+	old, err := utils.ReadLink(path)
+	if err != nil {
+		return err
+	}
+	if err := utils.SetSymlink(path, target); err != nil {
+		return err
+	}
+	return addBackup(Backup{Target: path, OldTarget: old})
+}
+
+func recordBackup(target, backup string) error {
+	return addBackup(Backup{Target: target, Path: backup})
+}
+
+// addBackup adds b to the index, stamped with this run. The index is read
+// and written back under ResBackups, so backups made in parallel are all
+// kept.
+func addBackup(b Backup) error {
+	_, release := resources.Acquire(context.Background(), WriteLock(ResBackups))
+	defer release()
+	backups, err := LoadBackups()
+	if err != nil {
+		return err
+	}
+	b.Run, b.Created = runID, time.Now().UTC()
+	return saveBackups(append(backups, b))
+}
+
+// RestoreBackup copies a backup of target back into place, or points a
+// repointed symlink back at its old target. With at empty the newest backup
+// is used; otherwise the newest whose stamp or run starts with at. What is
+// being replaced is itself backed up first.
+func RestoreBackup(target, at string) (Backup, error) {
+	backups, err := LoadBackups()
+	if err != nil {
+		return Backup{}, err
+	}
+	var found *Backup
+	for i := range backups {
+		b := &backups[i]
+		if b.Target != target {
+			continue
+		}
+		if at == "" || strings.HasPrefix(b.Stamp(), at) || strings.HasPrefix(b.Run, at) {
+			found = b
+		}
+	}
+	if found == nil {
+		if at != "" {
+			return Backup{}, fmt.Errorf("no backup of %s at %s", target, at)
+		}
+		return Backup{}, fmt.Errorf("no backups of %s", target)
+	}
+
+	if found.OldTarget != "" {
+		return *found, restoreLink(target, found.OldTarget)
+	}
+	content, err := os.ReadFile(found.Path)
+	if err != nil {
+		return *found, err
+	}
+	info, err := os.Stat(found.Path)
+	if err != nil {
+		return *found, err
+	}
+	_, err = writeWithBackup(target, content, info.Mode().Perm())
+	return *found, err
+}
+
+// restoreLink makes path a symlink to oldTarget again.
+func restoreLink(path, oldTarget string) error {
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return utils.SetSymlink(path, oldTarget)
+	case err != nil:
+		return err
+	case info.Mode()&os.ModeSymlink != 0:
+		return relink(path, oldTarget)
+	}
+	if _, err := moveToBackup(path); err != nil {
+		return err
+	}
+	return utils.SetSymlink(path, oldTarget)
+}
+
+// PruneBackups deletes backups beyond the newest keep of each file that are
+// also older than olderThan (zero for any age), and returns what it deleted.
+// Index entries whose file is already gone are dropped as well; symlink
+// entries have no file and are only dropped from the index.
+func PruneBackups(keep int, olderThan time.Duration) ([]Backup, error) {
+	_, release := resources.Acquire(context.Background(), WriteLock(ResBackups))
+	defer release()
+	backups, err := LoadBackups()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]int)
+	prune := make([]bool, len(backups))
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		seen[b.Target]++
+		if seen[b.Target] > keep && time.Since(b.Created) > olderThan {
+			prune[i] = true
+		}
+	}
+
+	var kept, pruned []Backup
+	for i, b := range backups {
+		if b.OldTarget != "" {
+			// Nothing on disk to delete for a symlink.
+			if !prune[i] {
+				kept = append(kept, b)
+			} else {
+				pruned = append(pruned, b)
+			}
+			continue
+		}
+		if _, err := os.Lstat(b.Path); os.IsNotExist(err) {
+			continue
+		}
+		if !prune[i] {
+			kept = append(kept, b)
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil {
+			kept = append(kept, b)
+			_ = saveBackups(append(kept, backups[i+1:]...))
+			return pruned, err
+		}
+		pruned = append(pruned, b)
+	}
+	return pruned, saveBackups(kept)
+}
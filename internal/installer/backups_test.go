@@ -0,0 +1,87 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestBackupsRestoreAndPrune(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dest := filepath.Join(home, ".zshrc")
+
+	for _, content := range []string{"v1", "v2", "v3", "v4"} {
+		if _, err := writeWithBackup(dest, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := LoadBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("got %d backups, want 3", len(backups))
+	}
+
+	// The newest backup holds v3; restoring it backs up v4 in turn.
+	b, err := RestoreBackup(dest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "v3" {
+		t.Fatalf("restored %q from %s, want v3", got, b.Path)
+	}
+	if _, err := RestoreBackup(dest, "19990101"); err == nil {
+		t.Fatal("expected an error for an unknown timestamp")
+	}
+
+	pruned, err := PruneBackups(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 {
+		t.Fatalf("pruned %d backups, want 2", len(pruned))
+	}
+	for _, p := range pruned {
+		if _, err := os.Stat(p.Path); !os.IsNotExist(err) {
+			t.Fatalf("%s still exists", p.Path)
+		}
+	}
+	left, err := LoadBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 2 {
+		t.Fatalf("%d backups left in the index, want 2", len(left))
+	}
+	if got, _ := os.ReadFile(left[1].Path); string(got) != "v4" {
+		t.Fatalf("newest backup holds %q, want v4", got)
+	}
+}
+
+func TestRecordBackupInParallel(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target := filepath.Join(home, fmt.Sprintf("file%d", i))
+			if err := recordBackup(target, target+".bak.1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	backups, err := LoadBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 20 {
+		t.Fatalf("got %d backups in the index, want 20", len(backups))
+	}
+}
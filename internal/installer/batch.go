@@ -0,0 +1,192 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// batchOutcome is what brew's output says about one package of a batch.
+type batchOutcome struct {
+	Status InstallStatus
+	Error  string
+}
+
+var (
+	// "🍺  /opt/homebrew/Cellar/tree/2.2.1: 9 files, 178.9KB"
+	batchPouredRe = regexp.MustCompile(`/Cellar/([^/\s]+)/[^:\s]+: \d+ files?`)
+	// "🍺  firefox was successfully installed!"
+	batchCaskInstalledRe = regexp.MustCompile(`^\S+\s+(\S+) was successfully installed!`)
+	// "Warning: tree 2.2.1 is already installed and up-to-date."
+	batchAlreadyRe = regexp.MustCompile(`^Warning: (\S+) \S+ is already installed`)
+	// "Warning: Not upgrading firefox, the latest version is already installed"
+	// "Warning: Cask 'firefox' is already installed."
+	batchCaskAlreadyRe = regexp.MustCompile(`^Warning: (?:Not upgrading (\S+), the latest version is already installed|Cask '([^']+)' is already installed)`)
+	// The forms of "Error: ..." that name the package that failed. Other
+	// names on the line, such as a "Did you mean ...?" suggestion, are not
+	// failures.
+	batchErrorRes = []*regexp.Regexp{
+		// "No available formula with the name "lazygti". Did you mean lazygit?"
+		regexp.MustCompile(`^No available (?:formula|cask|formula or cask) with the name "([^"]+)"`),
+		// "Cask 'zooom' is unavailable: No Cask with this name exists."
+		regexp.MustCompile(`^Cask '([^']+)' is unavailable`),
+		// "fd: Failed to download resource "fd (14.0.0)""
+		regexp.MustCompile(`^([\w@.+-]+(?:/[\w@.+-]+)*): `),
+	}
+)
+
+// parseBatchOutput maps each of names to the outcome brew printed for it.
+// Names brew said nothing recognizable about are left out. Tapped names
+// ("user/tap/name") match on their last segment.
+func parseBatchOutput(output string, names []string) map[string]batchOutcome {
+	byShort := make(map[string]string, len(names))
+	for _, n := range names {
+		byShort[n[strings.LastIndex(n, "/")+1:]] = n
+	}
+	outcomes := make(map[string]batchOutcome)
+	set := func(short string, o batchOutcome) {
+		name, ok := byShort[short]
+		if !ok {
+			return
+		}
+		// An error anywhere wins over an earlier success line.
+		if prev, seen := outcomes[name]; seen && prev.Status == StatusFailed {
+			return
+		}
+		outcomes[name] = o
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Error:"):
+			msg := strings.TrimSpace(strings.TrimPrefix(line, "Error:"))
+			for _, re := range batchErrorRes {
+				if m := re.FindStringSubmatch(msg); m != nil {
+					set(m[1][strings.LastIndex(m[1], "/")+1:], batchOutcome{Status: StatusFailed, Error: msg})
+					break
+				}
+			}
+		case batchPouredRe.MatchString(line):
+			set(batchPouredRe.FindStringSubmatch(line)[1], batchOutcome{Status: StatusInstalled})
+		case batchCaskInstalledRe.MatchString(line):
+			set(batchCaskInstalledRe.FindStringSubmatch(line)[1], batchOutcome{Status: StatusInstalled})
+		case batchCaskAlreadyRe.MatchString(line):
+			m := batchCaskAlreadyRe.FindStringSubmatch(line)
+			set(m[1]+m[2], batchOutcome{Status: StatusSkipped})
+		case batchAlreadyRe.MatchString(line):
+			set(batchAlreadyRe.FindStringSubmatch(line)[1], batchOutcome{Status: StatusSkipped})
+		}
+	}
+	return outcomes
+}
+
+// installFormulasBatch installs every missing formula with one `brew install`,
+// then falls back to installFormula for the ones the batch did not install.
+func (m *Manager) installFormulasBatch(ctx context.Context, formulas []config.Package, downloads map[string]time.Duration) []InstallResult {
+	var results []InstallResult
+	var pending []config.Package
+	for _, pkg := range formulas {
+		installed, err := IsBrewPackageInstalled(ctx, m.verbose, pkg)
+		if err != nil || !installed {
+			pending = append(pending, pkg)
+			continue
+		}
+		status, msg, errStr := m.existingFormula(ctx, pkg)
+		m.emit(pkg, status, msg, errStr)
+		results = append(results, InstallResult{Package: pkg, Status: status, Message: msg, Error: errStr})
+	}
+	results = append(results, m.runBatch(ctx, pending, downloads, m.installFormula)...)
+	sort.Slice(results, func(i, j int) bool {
+		return strings.Compare(results[i].Package.Name, results[j].Package.Name) < 0
+	})
+	return results
+}
+
+// installCasksBatch is installFormulasBatch for casks. Casks that are already
+// installed or whose app exists outside Homebrew go through installCask so the
+// adoption policy applies.
+func (m *Manager) installCasksBatch(ctx context.Context, casks []config.Package, downloads map[string]time.Duration) []InstallResult {
+	var results []InstallResult
+	var pending []config.Package
+	for _, cask := range casks {
+		if utils.IsMacOS() {
+			installed, err := IsBrewPackageInstalled(ctx, m.verbose, cask)
+			if err == nil && !installed {
+				if _, exists := m.casks.findApp(ctx, m.verbose, cask); !exists {
+					pending = append(pending, cask)
+					continue
+				}
+			}
+		}
+		results = append(results, m.installCask(ctx, cask, downloads))
+	}
+	return append(results, m.runBatch(ctx, pending, downloads, m.installCask)...)
+}
+
+// runBatch installs pending with InstallBatch and keeps one result row per
+// package. Packages the batch failed, or left uninstalled without saying why,
+// are retried one by one with fallback.
+func (m *Manager) runBatch(ctx context.Context, pending []config.Package, downloads map[string]time.Duration,
+	fallback func(context.Context, config.Package, map[string]time.Duration) InstallResult,
+) []InstallResult {
+	if len(pending) == 0 {
+		return nil
+	}
+	if stopRequested(ctx) {
+		var results []InstallResult
+		for _, pkg := range pending {
+			results = append(results, m.cancelled(pkg))
+		}
+		return results
+	}
+	names := make([]string, 0, len(pending))
+	for _, pkg := range pending {
+		names = append(names, pkg.Name)
+		m.emit(pkg, StatusRunning, fmt.Sprintf("Installing in a batch of %d", len(pending)), "")
+	}
+
+	ctx, release, _ := lockBrew(ctx)
+	defer release()
+	start := time.Now()
+	batchTask := config.Package{Name: fmt.Sprintf("brew install (%d %ss)", len(pending), pending[0].Type), Type: config.TypeTask, Category: "core"}
+	// The batch does the work of len(pending) installs, so it gets their time.
+	limits := m.limits(stepKind(pending[0]))
+	limits.Timeout *= time.Duration(len(pending))
+	batchCtx := utils.WithLimits(m.withOutput(ctx, batchTask), limits)
+	output, batchErr := InstallBatch(batchCtx, m.verbose, pending[0].Type == config.TypeCask, names)
+	// brew does not report per-package times; split the batch evenly.
+	share := time.Since(start) / time.Duration(len(pending))
+	outcomes := parseBatchOutput(output, names)
+
+	var results []InstallResult
+	for _, pkg := range pending {
+		o, ok := outcomes[pkg.Name]
+		if !ok && batchErr != nil {
+			if installed, err := IsBrewPackageInstalled(ctx, m.verbose, pkg); err == nil && installed {
+				o, ok = batchOutcome{Status: StatusInstalled}, true
+			}
+		} else if !ok {
+			// brew exited cleanly, so everything it was given is installed.
+			o, ok = batchOutcome{Status: StatusInstalled}, true
+		}
+		if !ok || o.Status == StatusFailed {
+			results = append(results, fallback(ctx, pkg, downloads))
+			continue
+		}
+
+		msg := fmt.Sprintf("Installed in a batch of %d", len(pending))
+		if o.Status == StatusSkipped {
+			msg = "Already installed"
+		}
+		m.emit(pkg, o.Status, msg, "")
+		results = append(results, InstallResult{Package: pkg, Status: o.Status, Message: msg, Duration: share, DownloadDuration: downloads[pkg.Name]})
+	}
+	return results
+}
@@ -0,0 +1,87 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBatchOutput(t *testing.T) {
+	cases := []struct {
+		fixture string
+		names   []string
+		want    map[string]InstallStatus
+	}{
+		{
+			fixture: "brew-install-batch-ok.txt",
+			names:   []string{"bat", "jq", "tree"},
+			want:    map[string]InstallStatus{"bat": StatusSkipped, "jq": StatusInstalled, "tree": StatusInstalled},
+		},
+		{
+			fixture: "brew-install-batch-partial.txt",
+			names:   []string{"nikitabobko/tap/aerospace", "fd", "lazygti", "ripgrep", "zoxide"},
+			want: map[string]InstallStatus{
+				"nikitabobko/tap/aerospace": StatusInstalled,
+				"fd":                        StatusFailed,
+				"lazygti":                   StatusFailed,
+				"ripgrep":                   StatusInstalled,
+			},
+		},
+		{
+			fixture: "brew-install-batch-casks.txt",
+			names:   []string{"firefox", "raycast", "rectangle", "slack", "zooom"},
+			want: map[string]InstallStatus{
+				"firefox":   StatusInstalled,
+				"raycast":   StatusSkipped,
+				"rectangle": StatusSkipped,
+				"zooom":     StatusFailed,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			outcomes := parseBatchOutput(string(data), tc.names)
+			got := make(map[string]InstallStatus, len(outcomes))
+			for name, o := range outcomes {
+				got[name] = o.Status
+				if o.Status == StatusFailed && o.Error == "" {
+					t.Fatalf("%s: failed without an error message", name)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v\nwant %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseBatchOutputErrorWins(t *testing.T) {
+	out := strings.Join([]string{
+		"🍺  /opt/homebrew/Cellar/fd/10.2.0: 14 files, 3.1MB",
+		"Error: fd: post-install step did not complete successfully",
+	}, "\n")
+	if o := parseBatchOutput(out, []string{"fd"})["fd"]; o.Status != StatusFailed {
+		t.Fatalf("got %q, want failed", o.Status)
+	}
+}
+
+func TestParseBatchOutputSuggestionNotFailed(t *testing.T) {
+	out := strings.Join([]string{
+		"🍺  /opt/homebrew/Cellar/lazygit/0.44.1: 8 files, 19.6MB",
+		`Error: No available formula with the name "lazygti". Did you mean lazygit?`,
+	}, "\n")
+	got := parseBatchOutput(out, []string{"lazygit", "lazygti"})
+	if got["lazygti"].Status != StatusFailed {
+		t.Fatalf("lazygti: got %q, want failed", got["lazygti"].Status)
+	}
+	if got["lazygit"].Status != StatusInstalled {
+		t.Fatalf("lazygit named in a suggestion: got %q, want installed", got["lazygit"].Status)
+	}
+}
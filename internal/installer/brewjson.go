@@ -0,0 +1,181 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"macsetup/internal/utils"
+)
+
+// BrewInfo is the document printed by `brew info --json=v2`.
+type BrewInfo struct {
+	Formulae []BrewFormula `json:"formulae"`
+	Casks    []BrewCask    `json:"casks"`
+}
+
+// BrewFormula holds the subset of formula fields macsetup relies on.
+type BrewFormula struct {
+	Name          string                 `json:"name"`
+	FullName      string                 `json:"full_name"`
+	Tap           string                 `json:"tap"`
+	Aliases       []string               `json:"aliases"`
+	OldNames      []string               `json:"oldnames"`
+	Versions      BrewFormulaVersions    `json:"versions"`
+	KegOnly       bool                   `json:"keg_only"`
+	KegOnlyReason *BrewKegOnlyReason     `json:"keg_only_reason"`
+	Installed     []BrewInstalledVersion `json:"installed"`
+	LinkedKeg     *string                `json:"linked_keg"`
+}
+
+type BrewFormulaVersions struct {
+	Stable string `json:"stable"`
+}
+
+type BrewKegOnlyReason struct {
+	Reason      string `json:"reason"`
+	Explanation string `json:"explanation"`
+}
+
+type BrewInstalledVersion struct {
+	Version            string `json:"version"`
+	InstalledOnRequest bool   `json:"installed_on_request"`
+}
+
+// BrewCask holds the subset of cask fields macsetup relies on.
+type BrewCask struct {
+	Token     string            `json:"token"`
+	FullToken string            `json:"full_token"`
+	Name      []string          `json:"name"`
+	Version   string            `json:"version"`
+	Installed *string           `json:"installed"`
+	Artifacts []json.RawMessage `json:"artifacts"`
+}
+
+// ParseBrewInfo decodes the output of `brew info --json=v2`.
+func ParseBrewInfo(data []byte) (BrewInfo, error) {
+	var info BrewInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return BrewInfo{}, fmt.Errorf("failed to parse brew info: %w", err)
+	}
+	return info, nil
+}
+
+// Formula returns the entry matching name by name, full name, alias or old name.
+func (i BrewInfo) Formula(name string) (BrewFormula, bool) {
+	for _, f := range i.Formulae {
+		if f.matches(name) {
+			return f, true
+		}
+	}
+	return BrewFormula{}, false
+}
+
+// Cask returns the entry matching token.
+func (i BrewInfo) Cask(token string) (BrewCask, bool) {
+	for _, c := range i.Casks {
+		if c.Token == token || c.FullToken == token {
+			return c, true
+		}
+	}
+	return BrewCask{}, false
+}
+
+func (f BrewFormula) matches(name string) bool {
+	if f.Name == name || f.FullName == name {
+		return true
+	}
+	for _, alias := range f.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	for _, old := range f.OldNames {
+		if old == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f BrewFormula) IsInstalled() bool {
+	return len(f.Installed) > 0
+}
+
+func (f BrewFormula) IsLinked() bool {
+	return f.LinkedKeg != nil && *f.LinkedKeg != ""
+}
+
+// LinkState describes whether an installed formula is reachable from the brew prefix.
+type LinkState int
+
+const (
+	LinkNotInstalled LinkState = iota
+	LinkLinked
+	LinkUnlinked
+	// LinkKegOnly means the formula is installed but intentionally not linked by Homebrew.
+	LinkKegOnly
+)
+
+func (s LinkState) String() string {
+	switch s {
+	case LinkLinked:
+		return "linked"
+	case LinkUnlinked:
+		return "unlinked"
+	case LinkKegOnly:
+		return "keg-only"
+	default:
+		return "not installed"
+	}
+}
+
+func (f BrewFormula) LinkState() LinkState {
+	switch {
+	case !f.IsInstalled():
+		return LinkNotInstalled
+	case f.IsLinked():
+		return LinkLinked
+	case f.KegOnly:
+		return LinkKegOnly
+	default:
+		return LinkUnlinked
+	}
+}
+
+// ErrKegOnly is returned when asked to link a formula Homebrew keeps keg-only.
+var ErrKegOnly = errors.New("formula is keg-only")
+
+// FormulaInfo runs `brew info --json=v2 --formula` for name and returns its entry.
+func FormulaInfo(ctx context.Context, verbose bool, name string) (BrewFormula, error) {
+	ctx, release := resources.Acquire(ctx, ReadLock(ResBrew))
+	defer release()
+	res, err := utils.Run(ctx, verbose, 10*time.Second, GetBrewExecutable(), "info", "--json=v2", "--formula", name)
+	if err != nil {
+		if strings.TrimSpace(res.Stderr) != "" {
+			return BrewFormula{}, fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+		}
+		return BrewFormula{}, err
+	}
+	info, err := ParseBrewInfo([]byte(res.Stdout))
+	if err != nil {
+		return BrewFormula{}, err
+	}
+	f, ok := info.Formula(name)
+	if !ok {
+		return BrewFormula{}, fmt.Errorf("brew info returned no formula named %q", name)
+	}
+	return f, nil
+}
+
+// FormulaLinkState reports the link state of name, treating lookup failures as not installed.
+func FormulaLinkState(ctx context.Context, verbose bool, name string) LinkState {
+	f, err := FormulaInfo(ctx, verbose, name)
+	if err != nil {
+		return LinkNotInstalled
+	}
+	return f.LinkState()
+}
@@ -0,0 +1,74 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadBrewInfo(t *testing.T, name string) BrewInfo {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := ParseBrewInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestFormulaLinkStateFromFixtures(t *testing.T) {
+	cases := []struct {
+		fixture string
+		formula string
+		want    LinkState
+	}{
+		{fixture: "brew-info-linked.json", formula: "tree", want: LinkLinked},
+		{fixture: "brew-info-unlinked.json", formula: "neovim", want: LinkUnlinked},
+		{fixture: "brew-info-unlinked.json", formula: "nvim", want: LinkUnlinked},
+		{fixture: "brew-info-keg-only.json", formula: "postgresql@17", want: LinkKegOnly},
+		{fixture: "brew-info-not-installed.json", formula: "redis", want: LinkNotInstalled},
+		{fixture: "brew-info-multiple.json", formula: "docker", want: LinkNotInstalled},
+		{fixture: "brew-info-multiple.json", formula: "docker-compose", want: LinkLinked},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.fixture+"/"+tc.formula, func(t *testing.T) {
+			info := loadBrewInfo(t, tc.fixture)
+			f, ok := info.Formula(tc.formula)
+			if !ok {
+				t.Fatalf("formula %q not found", tc.formula)
+			}
+			if got := f.LinkState(); got != tc.want {
+				t.Fatalf("link state: got %s want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBrewInfoLookupMisses(t *testing.T) {
+	info := loadBrewInfo(t, "brew-info-multiple.json")
+	if _, ok := info.Formula("docker-desktop"); ok {
+		t.Fatalf("expected no formula match")
+	}
+	c, ok := info.Cask("docker")
+	if !ok {
+		t.Fatalf("expected cask match")
+	}
+	if c.Version != "4.37.1,178610" {
+		t.Fatalf("cask version: got %q", c.Version)
+	}
+}
+
+func TestParseBrewInfoIgnoresWhitespace(t *testing.T) {
+	compact := loadBrewInfo(t, "brew-info-unlinked.json")
+	f, ok := compact.Formula("neovim")
+	if !ok || f.IsLinked() {
+		t.Fatalf("expected unlinked neovim in compact JSON")
+	}
+	if _, err := ParseBrewInfo([]byte("not json")); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
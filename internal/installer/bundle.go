@@ -0,0 +1,405 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// BundleManifestFile is the manifest written at the root of an offline bundle.
+const BundleManifestFile = "manifest.json"
+
+// Kinds of entries recorded in a bundle manifest.
+const (
+	BundleScript    = "script"
+	BundleGit       = "git"
+	BundleBrewCache = "brew-cache"
+)
+
+// BundleManifest describes the contents of an offline bundle.
+type BundleManifest struct {
+	CreatedAt time.Time     `json:"created_at"`
+	Platform  string        `json:"platform"`
+	Formulae  []string      `json:"formulae"`
+	Casks     []string      `json:"casks"`
+	Taps      []string      `json:"taps"`
+	Entries   []BundleEntry `json:"entries"`
+}
+
+// BundleEntry is one downloaded artifact. Files carry a SHA-256 digest, git
+// mirrors the commit their HEAD pointed at.
+type BundleEntry struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// Bundle is an opened and verified offline bundle.
+type Bundle struct {
+	Dir      string
+	Manifest BundleManifest
+}
+
+func bundlePlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// tapRemote returns the GitHub repository behind a "user/repo" tap.
+func tapRemote(tap string) string {
+	user, repo, _ := strings.Cut(tap, "/")
+	return fmt.Sprintf("https://github.com/%s/homebrew-%s", user, repo)
+}
+
+// CreateBundle downloads everything an offline run of selected needs into dir:
+// the install scripts, git mirrors of the repositories macsetup and the
+// install scripts clone (a git dotfiles source included), taps, and
+// Homebrew's download cache for every formula and cask (fetched with `brew
+// fetch`).
+func CreateBundle(ctx context.Context, dir string, selected map[string]bool, settings config.Settings, out io.Writer) (BundleManifest, error) {
+	src := settings.ResolvedSources()
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return BundleManifest{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return BundleManifest{}, err
+	}
+
+	logf := func(format string, args ...any) {
+		if out != nil {
+			_, _ = fmt.Fprintf(out, format+"\n", args...)
+		}
+	}
+
+	taps, formulas, casks := splitBrewPackages(selectedPackages(selected))
+	manifest := BundleManifest{CreatedAt: time.Now().UTC(), Platform: bundlePlatform()}
+	for _, t := range taps {
+		manifest.Taps = append(manifest.Taps, t.Tap)
+	}
+	for _, f := range formulas {
+		manifest.Formulae = append(manifest.Formulae, f.Name)
+	}
+	if utils.IsMacOS() {
+		for _, c := range casks {
+			manifest.Casks = append(manifest.Casks, c.Name)
+		}
+	}
+
+	scripts := []struct {
+		name  string
+		asset config.Asset
+	}{
+		{name: "homebrew-install.sh", asset: src.HomebrewInstallScript},
+		{name: "ohmyzsh-install.sh", asset: src.OhMyZshInstallScript},
+	}
+	for _, s := range scripts {
+		rel := filepath.Join("scripts", s.name)
+		logf("script: %s", s.asset.URL)
+		if err := downloadAsset(ctx, false, s.asset, filepath.Join(dir, rel)); err != nil {
+			return manifest, fmt.Errorf("failed to download %s: %w", s.asset.URL, err)
+		}
+		sum, err := utils.FileSHA256(filepath.Join(dir, rel))
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Entries = append(manifest.Entries, BundleEntry{Kind: BundleScript, Name: s.name, Path: rel, Source: s.asset.URL, SHA256: sum})
+	}
+
+	type bundleRepo struct {
+		name  string
+		asset config.Asset
+	}
+	repos := []bundleRepo{
+		{name: "brew", asset: src.HomebrewRepo},
+		{name: "ohmyzsh", asset: src.OhMyZshRepo},
+		{name: "kickstart.nvim", asset: src.KickstartNvim},
+		{name: "tpm", asset: src.TPM},
+	}
+	plugins := make([]string, 0, len(src.ZshPlugins))
+	for name := range src.ZshPlugins {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+	for _, name := range plugins {
+		repos = append(repos, bundleRepo{name: "zsh-plugins/" + name, asset: src.ZshPlugins[name]})
+	}
+	if dotfiles := settings.Dotfiles.Source; dotfiles.URL != "" && !isLocalSource(dotfiles.URL) {
+		repos = append(repos, bundleRepo{name: "dotfiles", asset: settings.Network.RewriteAsset(dotfiles)})
+	}
+	for _, tap := range manifest.Taps {
+		repos = append(repos, bundleRepo{name: "taps/" + tap, asset: config.Asset{URL: settings.Network.Rewrite(tapRemote(tap))}})
+	}
+	for _, r := range repos {
+		rel := filepath.Join("git", r.name+".git")
+		logf("git: %s", r.asset.URL)
+		commit, err := mirrorRepo(ctx, r.asset, filepath.Join(dir, rel))
+		if err != nil {
+			return manifest, fmt.Errorf("failed to mirror %s: %w", r.asset.URL, err)
+		}
+		manifest.Entries = append(manifest.Entries, BundleEntry{Kind: BundleGit, Name: r.name, Path: rel, Source: r.asset.URL, Commit: commit})
+	}
+
+	cacheDir := filepath.Join(dir, "brew-cache")
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return manifest, err
+	}
+	// brew fetch downloads into $HOMEBREW_CACHE; point it into the bundle for
+	// the duration of the fetches.
+	prevCache, hadCache := os.LookupEnv("HOMEBREW_CACHE")
+	_ = os.Setenv("HOMEBREW_CACHE", cacheDir)
+	defer func() {
+		if hadCache {
+			_ = os.Setenv("HOMEBREW_CACHE", prevCache)
+		} else {
+			_ = os.Unsetenv("HOMEBREW_CACHE")
+		}
+	}()
+	for _, tap := range manifest.Taps {
+		if err := AddTap(ctx, false, tap, ""); err != nil {
+			return manifest, err
+		}
+	}
+	if len(manifest.Formulae) > 0 {
+		logf("brew fetch: %d formulae", len(manifest.Formulae))
+		args := append([]string{"fetch", "--formula", "--deps"}, manifest.Formulae...)
+		if err := runBrew(ctx, args...); err != nil {
+			return manifest, err
+		}
+	}
+	if len(manifest.Casks) > 0 {
+		logf("brew fetch: %d casks", len(manifest.Casks))
+		args := append([]string{"fetch", "--cask"}, manifest.Casks...)
+		if err := runBrew(ctx, args...); err != nil {
+			return manifest, err
+		}
+	}
+
+	cacheEntries, err := hashTree(dir, "brew-cache")
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Entries = append(manifest.Entries, cacheEntries...)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, BundleManifestFile), append(data, '\n'), 0o644); err != nil {
+		return manifest, err
+	}
+	logf("bundle written to %s", dir)
+	return manifest, nil
+}
+
+// OpenBundle reads dir's manifest and verifies every recorded checksum.
+func OpenBundle(dir string) (*Bundle, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, BundleManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("not an offline bundle: %w", err)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if manifest.Platform != bundlePlatform() {
+		return nil, fmt.Errorf("bundle was created for %s, this machine is %s", manifest.Platform, bundlePlatform())
+	}
+	for _, e := range manifest.Entries {
+		path := filepath.Join(dir, e.Path)
+		if !utils.Exists(path) {
+			return nil, fmt.Errorf("bundle is missing %s", e.Path)
+		}
+		if e.SHA256 == "" {
+			continue
+		}
+		sum, err := utils.FileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		if sum != e.SHA256 {
+			return nil, fmt.Errorf("bundle checksum mismatch for %s", e.Path)
+		}
+	}
+	return &Bundle{Dir: dir, Manifest: manifest}, nil
+}
+
+func (b *Bundle) entry(kind, name string) (string, bool) {
+	for _, e := range b.Manifest.Entries {
+		if e.Kind == kind && e.Name == name {
+			return filepath.Join(b.Dir, e.Path), true
+		}
+	}
+	return "", false
+}
+
+// Sources points every remote source at its copy inside the bundle. Pins are
+// taken over from pinned, so a bundled script or clone is held to the same
+// digest or ref as a download would be.
+func (b *Bundle) Sources(pinned config.Sources) config.Sources {
+	local := func(kind, name string, pin config.Asset) config.Asset {
+		p, ok := b.entry(kind, name)
+		if !ok {
+			return config.Asset{}
+		}
+		if kind == BundleScript {
+			p = "file://" + p
+		}
+		return config.Asset{URL: p, SHA256: pin.SHA256, Ref: pin.Ref}
+	}
+	src := config.Sources{
+		HomebrewInstallScript: local(BundleScript, "homebrew-install.sh", pinned.HomebrewInstallScript),
+		OhMyZshInstallScript:  local(BundleScript, "ohmyzsh-install.sh", pinned.OhMyZshInstallScript),
+		KickstartNvim:         local(BundleGit, "kickstart.nvim", pinned.KickstartNvim),
+		TPM:                   local(BundleGit, "tpm", pinned.TPM),
+		HomebrewRepo:          local(BundleGit, "brew", pinned.HomebrewRepo),
+		OhMyZshRepo:           local(BundleGit, "ohmyzsh", pinned.OhMyZshRepo),
+		ZshPlugins:            make(map[string]config.Asset),
+	}
+	for _, e := range b.Manifest.Entries {
+		if name, ok := strings.CutPrefix(e.Name, "zsh-plugins/"); ok && e.Kind == BundleGit {
+			src.ZshPlugins[name] = local(BundleGit, e.Name, pinned.ZshPlugins[name])
+		}
+	}
+	return src
+}
+
+// DotfilesSource points a git dotfiles source at its mirror in the bundle,
+// keeping the ref. A local source, or none, is returned as is.
+func (b *Bundle) DotfilesSource(src config.Asset) (config.Asset, error) {
+	if src.URL == "" || isLocalSource(src.URL) {
+		return src, nil
+	}
+	p, ok := b.entry(BundleGit, "dotfiles")
+	if !ok {
+		return src, fmt.Errorf("the bundle has no copy of the dotfiles source %s; create it again with that source configured", src.URL)
+	}
+	// As a URL, so that it is cloned like a remote rather than read as a
+	// directory.
+	return config.Asset{URL: "file://" + p, Ref: src.Ref}, nil
+}
+
+// TapRemote returns the bundled mirror for tap, if any.
+func (b *Bundle) TapRemote(tap string) string {
+	p, _ := b.entry(BundleGit, "taps/"+tap)
+	return p
+}
+
+// Env returns the environment that makes brew and the install scripts use the
+// bundle instead of the network.
+func (b *Bundle) Env() []string {
+	env := []string{
+		"HOMEBREW_CACHE=" + filepath.Join(b.Dir, "brew-cache"),
+		"HOMEBREW_NO_AUTO_UPDATE=1",
+		// Keep brew from pruning the bundle's cache after installs.
+		"HOMEBREW_NO_INSTALL_CLEANUP=1",
+	}
+	if p, ok := b.entry(BundleGit, "brew"); ok {
+		env = append(env, "HOMEBREW_BREW_GIT_REMOTE="+p)
+	}
+	if p, ok := b.entry(BundleGit, "ohmyzsh"); ok {
+		// Read by the Oh My Zsh install script.
+		env = append(env, "REMOTE="+p)
+	}
+	return env
+}
+
+// ApplyOffline exports the bundle environment into the process, like ApplyNetwork.
+func ApplyOffline(b *Bundle) error {
+	for _, kv := range b.Env() {
+		key, value, _ := strings.Cut(kv, "=")
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// mirrorRepo creates or refreshes a bare mirror of repo at dest and returns the
+// commit of its pinned ref, or of HEAD when unpinned.
+func mirrorRepo(ctx context.Context, repo config.Asset, dest string) (string, error) {
+	err := utils.Retry(ctx, false, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
+		var res utils.CmdResult
+		var err error
+		if utils.Exists(dest) {
+			res, err = utils.Run(ctx, false, 0, "git", "--git-dir", dest, "remote", "update", "--prune")
+		} else {
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			res, err = utils.Run(ctx, false, 0, "git", "clone", "--mirror", repo.URL, dest)
+		}
+		if err != nil {
+			if strings.TrimSpace(res.Stderr) != "" {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if repo.Ref != "" {
+		return resolveRef(ctx, dest, repo)
+	}
+	res, err := utils.Run(ctx, false, 10*time.Second, "git", "--git-dir", dest, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+func runBrew(ctx context.Context, args ...string) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	res, err := utils.Run(ctx, false, 0, GetBrewExecutable(), args...)
+	if err != nil {
+		if strings.TrimSpace(res.Stderr) != "" {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+		}
+		return err
+	}
+	return nil
+}
+
+// hashTree records every regular file under dir/rel as a brew-cache entry.
+func hashTree(dir, rel string) ([]BundleEntry, error) {
+	var entries []BundleEntry
+	err := filepath.WalkDir(filepath.Join(dir, rel), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		sum, err := utils.FileSHA256(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, BundleEntry{Kind: BundleBrewCache, Name: filepath.Base(path), Path: relPath, SHA256: sum})
+		return nil
+	})
+	return entries, err
+}
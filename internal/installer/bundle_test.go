@@ -0,0 +1,119 @@
+package installer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// writeTestBundle lays out a minimal bundle with one script and one git mirror.
+func writeTestBundle(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "scripts", "homebrew-install.sh")
+	if err := os.MkdirAll(filepath.Dir(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("#!/bin/bash\necho ok\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "git", "zsh-plugins", "zsh-completions.git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := utils.FileSHA256(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := BundleManifest{
+		Platform: bundlePlatform(),
+		Entries: []BundleEntry{
+			{Kind: BundleScript, Name: "homebrew-install.sh", Path: "scripts/homebrew-install.sh", SHA256: sum},
+			{Kind: BundleGit, Name: "zsh-plugins/zsh-completions", Path: "git/zsh-plugins/zsh-completions.git"},
+		},
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, BundleManifestFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOpenBundle(t *testing.T) {
+	dir := writeTestBundle(t)
+	b, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatalf("OpenBundle: %v", err)
+	}
+
+	pinned := config.Sources{ZshPlugins: map[string]config.Asset{"zsh-completions": {Ref: "0.35.0"}}}
+	src := b.Sources(pinned)
+	if want := "file://" + filepath.Join(dir, "scripts", "homebrew-install.sh"); src.HomebrewInstallScript.URL != want {
+		t.Fatalf("HomebrewInstallScript = %q, want %q", src.HomebrewInstallScript, want)
+	}
+	want := config.Asset{URL: filepath.Join(dir, "git", "zsh-plugins", "zsh-completions.git"), Ref: "0.35.0"}
+	if got := src.ZshPlugins["zsh-completions"]; got != want {
+		t.Fatalf("zsh-completions = %+v, want %+v", got, want)
+	}
+	if b.TapRemote("nikitabobko/tap") != "" {
+		t.Fatalf("expected no remote for an unbundled tap")
+	}
+
+	env := strings.Join(b.Env(), "\n")
+	if !strings.Contains(env, "HOMEBREW_CACHE="+filepath.Join(dir, "brew-cache")) {
+		t.Fatalf("Env missing HOMEBREW_CACHE:\n%s", env)
+	}
+}
+
+func TestOpenBundleChecksumMismatch(t *testing.T) {
+	dir := writeTestBundle(t)
+	script := filepath.Join(dir, "scripts", "homebrew-install.sh")
+	if err := os.WriteFile(script, []byte("tampered\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBundle(dir); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestOpenBundleMissing(t *testing.T) {
+	if _, err := OpenBundle(t.TempDir()); err == nil {
+		t.Fatalf("expected error for a directory without a manifest")
+	}
+}
+
+func TestTapRemote(t *testing.T) {
+	if got, want := tapRemote("nikitabobko/tap"), "https://github.com/nikitabobko/homebrew-tap"; got != want {
+		t.Fatalf("tapRemote = %q, want %q", got, want)
+	}
+}
+
+func TestBundleDotfilesSource(t *testing.T) {
+	b, err := OpenBundle(writeTestBundle(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := config.Asset{URL: "~/team/dotfiles"}
+	if got, err := b.DotfilesSource(local); err != nil || got != local {
+		t.Fatalf("local source = %+v, %v; want it unchanged", got, err)
+	}
+	if _, err := b.DotfilesSource(config.Asset{URL: "https://example.com/dotfiles.git"}); err == nil {
+		t.Fatal("expected an error for a git source the bundle lacks")
+	}
+
+	b.Manifest.Entries = append(b.Manifest.Entries, BundleEntry{Kind: BundleGit, Name: "dotfiles", Path: "git/dotfiles.git"})
+	got, err := b.DotfilesSource(config.Asset{URL: "https://example.com/dotfiles.git", Ref: "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (config.Asset{URL: "file://" + filepath.Join(b.Dir, "git", "dotfiles.git"), Ref: "v2"}); got != want {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package installer
+
+import (
+	"context"
+
+	"macsetup/internal/config"
+)
+
+type stopKey struct{}
+
+// WithStop returns a context carrying a graceful stop, and the function that
+// requests it. Once stop is called Run starts no further steps but lets the
+// ones already running finish; cancelling the context itself kills them.
+// Stops nest: a stop requested on an outer context also stops inner ones.
+func WithStop(ctx context.Context) (context.Context, func()) {
+	parent, _ := ctx.Value(stopKey{}).(context.Context)
+	if parent == nil {
+		parent = context.Background()
+	}
+	soft, stop := context.WithCancel(parent)
+	return context.WithValue(ctx, stopKey{}, soft), stop
+}
+
+// stopRequested reports whether no new work should start, either because a
+// graceful stop was requested or because ctx is done.
+func stopRequested(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	soft, _ := ctx.Value(stopKey{}).(context.Context)
+	return soft != nil && soft.Err() != nil
+}
+
+// cancelled reports pkg as never started.
+func (m *Manager) cancelled(pkg config.Package) InstallResult {
+	m.emit(pkg, StatusCancelled, "Not started", "")
+	return InstallResult{Package: pkg, Status: StatusCancelled, Message: "Not started"}
+}
@@ -0,0 +1,56 @@
+package installer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunStoppedBeforeStart(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "state", "checkpoint.json")
+	ctx, stop := WithStop(context.Background())
+	stop()
+
+	m := NewManager(2, RunOptions{Checkpoint: checkpoint})
+	go func() {
+		for range m.Progress() {
+		}
+	}()
+	summary, err := m.Run(ctx, DefaultSelection())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected := selectedPackages(DefaultSelection())
+	if len(summary.Results) < len(selected) {
+		t.Fatalf("got %d results for %d selected packages", len(summary.Results), len(selected))
+	}
+	for _, r := range summary.Results {
+		if r.Package.Name == "Xcode CLI Tools" {
+			continue // skipped outright on Linux
+		}
+		if r.Status != StatusCancelled {
+			t.Fatalf("%s: got %q want %q", r.Package.Name, r.Status, StatusCancelled)
+		}
+	}
+
+	cp, err := ReadCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Interrupted || len(cp.Results) != len(summary.Results) {
+		t.Fatalf("checkpoint: interrupted=%v with %d results, want %d", cp.Interrupted, len(cp.Results), len(summary.Results))
+	}
+}
+
+func TestWithStopNests(t *testing.T) {
+	outer, stopOuter := WithStop(context.Background())
+	inner, _ := WithStop(outer)
+	if stopRequested(inner) {
+		t.Fatalf("stop requested before any stop")
+	}
+	stopOuter()
+	if !stopRequested(inner) {
+		t.Fatalf("outer stop did not reach the inner context")
+	}
+}
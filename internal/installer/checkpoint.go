@@ -0,0 +1,80 @@
+package installer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// Checkpoint is the outcome of the last run as saved to disk, so an
+// interrupted run can be told apart from a finished one and picked up later.
+type Checkpoint struct {
+	Finished    time.Time         `json:"finished"`
+	Interrupted bool              `json:"interrupted"`
+	Results     []CheckpointEntry `json:"results"`
+}
+
+type CheckpointEntry struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Status  InstallStatus `json:"status"`
+	Message string        `json:"message,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// WriteCheckpoint saves s to path, replacing the previous checkpoint in one
+// step so that a crash never leaves half a file behind.
+func WriteCheckpoint(path string, s Summary) error {
+	cp := Checkpoint{Finished: time.Now().UTC(), Interrupted: s.CancelledCount() > 0}
+	for _, r := range s.Results {
+		cp.Results = append(cp.Results, CheckpointEntry{
+			Name:    r.Package.Name,
+			Type:    string(r.Package.Type),
+			Status:  r.Status,
+			Message: r.Message,
+			Error:   r.Error,
+		})
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.EnsureDir(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// checkpointTask names the result Run adds when the checkpoint could not be
+// written.
+const checkpointTask = "Save checkpoint"
+
+// CheckpointError returns why Run could not save the checkpoint, or "" if it
+// was saved or none was asked for.
+func (s Summary) CheckpointError() string {
+	for _, r := range s.Results {
+		if r.Package.Type == config.TypeTask && r.Package.Name == checkpointTask && r.Status == StatusFailed {
+			return r.Error
+		}
+	}
+	return ""
+}
+
+// ReadCheckpoint loads a checkpoint written by WriteCheckpoint.
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(data, &cp)
+	return cp, err
+}
@@ -0,0 +1,114 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// Managed blocks are the part of a user's config that macsetup owns. They
+// are delimited by marker comments in the file's own comment syntax:
+//
+//	# >>> macsetup >>>
+//	...
+//	# <<< macsetup <<<
+//
+// Everything outside the markers belongs to the user and is never touched.
+const (
+	blockBegin = ">>> macsetup >>>"
+	blockEnd   = "<<< macsetup <<<"
+	blockNote  = "Managed by macsetup: changes inside this block are overwritten."
+)
+
+// findBlock returns the byte range of the managed block in content, from the
+// start of the begin marker line to the end of the end marker line including
+// its newline. ok is false when there is no block; a begin marker without an
+// end marker (or the reverse) is an error, since guessing where the block
+// ends could eat user content.
+func findBlock(content []byte, comment string) (start, end int, ok bool, err error) {
+	begin := markerRe(comment, blockBegin)
+	finish := markerRe(comment, blockEnd)
+	b := begin.FindIndex(content)
+	e := finish.FindIndex(content)
+	switch {
+	case b == nil && e == nil:
+		return 0, 0, false, nil
+	case b == nil || e == nil || e[0] < b[0]:
+		return 0, 0, false, fmt.Errorf("unbalanced %q / %q markers", blockBegin, blockEnd)
+	}
+	return b[0], e[1], true, nil
+}
+
+func markerRe(comment, marker string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^[ \t]*` + regexp.QuoteMeta(comment) + `[ \t]*` + regexp.QuoteMeta(marker) + `[ \t]*(\r?\n|\z)`)
+}
+
+// renderBlock wraps body in begin and end markers.
+func renderBlock(comment string, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\n%s %s\n", comment, blockBegin, comment, blockNote)
+	b.Write(body)
+	if len(body) > 0 && !bytes.HasSuffix(body, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "%s %s\n", comment, blockEnd)
+	return b.Bytes()
+}
+
+// upsertBlock puts body into content's managed block, replacing the block in
+// place when there is one and otherwise inserting it at offset at (clamped to
+// the content). The result is the same however often it is applied.
+func upsertBlock(content []byte, comment string, body []byte, at int) ([]byte, error) {
+	block := renderBlock(comment, body)
+	start, end, ok, err := findBlock(content, comment)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return splice(content, start, end, block), nil
+	}
+
+	if at < 0 || at > len(content) {
+		at = len(content)
+	}
+	before, after := content[:at], content[at:]
+	var b bytes.Buffer
+	b.Write(before)
+	if len(before) > 0 {
+		if !bytes.HasSuffix(before, []byte("\n")) {
+			b.WriteByte('\n')
+		}
+		if !bytes.HasSuffix(before, []byte("\n\n")) {
+			b.WriteByte('\n')
+		}
+	}
+	b.Write(block)
+	if len(after) > 0 && !bytes.HasPrefix(after, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	b.Write(after)
+	return b.Bytes(), nil
+}
+
+// removeBlock drops the managed block from content along with one blank line
+// that separated it from the user's content. removed is false when there was
+// no block.
+func removeBlock(content []byte, comment string) (out []byte, removed bool, err error) {
+	start, end, ok, err := findBlock(content, comment)
+	if err != nil || !ok {
+		return content, false, err
+	}
+	if bytes.HasPrefix(content[end:], []byte("\n")) {
+		end++
+	} else if start > 1 && bytes.HasSuffix(content[:start], []byte("\n\n")) {
+		start--
+	}
+	return splice(content, start, end, nil), true, nil
+}
+
+func splice(content []byte, start, end int, repl []byte) []byte {
+	out := make([]byte, 0, len(content)-(end-start)+len(repl))
+	out = append(out, content[:start]...)
+	out = append(out, repl...)
+	return append(out, content[end:]...)
+}
@@ -0,0 +1,92 @@
+package installer
+
+import "testing"
+
+func TestUpsertBlock(t *testing.T) {
+	block := "# >>> macsetup >>>\n# " + blockNote + "\nset -g mouse on\n# <<< macsetup <<<\n"
+	cases := []struct {
+		name     string
+		existing string
+		at       int
+		want     string
+	}{
+		{name: "new file", existing: "", at: 0, want: block},
+		{name: "appended after user content", existing: "set -g history-limit 5000\n", at: -1, want: "set -g history-limit 5000\n\n" + block},
+		{name: "missing final newline", existing: "bind r source-file", at: -1, want: "bind r source-file\n\n" + block},
+		{name: "inserted at the top", existing: "bind r source-file\n", at: 0, want: block + "\nbind r source-file\n"},
+		{
+			name:     "replaced in place",
+			existing: "a\n\n# >>> macsetup >>>\nold\n# <<< macsetup <<<\n\nb\n",
+			at:       -1,
+			want:     "a\n\n" + block + "\nb\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := upsertBlock([]byte(tc.existing), "#", []byte("set -g mouse on\n"), tc.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+			again, err := upsertBlock(got, "#", []byte("set -g mouse on\n"), tc.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != string(got) {
+				t.Fatalf("not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestRemoveBlockRestoresUserContent(t *testing.T) {
+	for _, user := range []string{"", "export EDITOR=nvim\n", "a\n\nb\n"} {
+		merged, err := upsertBlock([]byte(user), "//", []byte("keybinds {}\n"), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, removed, err := removeBlock(merged, "//")
+		if err != nil || !removed {
+			t.Fatalf("removeBlock: removed=%v err=%v", removed, err)
+		}
+		if string(got) != user {
+			t.Fatalf("got %q want %q", got, user)
+		}
+	}
+}
+
+func TestUnbalancedMarkers(t *testing.T) {
+	for _, content := range []string{
+		"# >>> macsetup >>>\nstuff\n",
+		"stuff\n# <<< macsetup <<<\n",
+		"# <<< macsetup <<<\n# >>> macsetup >>>\n",
+	} {
+		if _, err := upsertBlock([]byte(content), "#", []byte("x\n"), -1); err == nil {
+			t.Fatalf("expected error for %q", content)
+		}
+	}
+}
+
+func TestMissingKDLNodes(t *testing.T) {
+	team := "// Prefix key like tmux.\nkeybinds clear-defaults=true {\n  normal { bind \"Ctrl a\" { SwitchToMode \"tmux\"; }; }\n}\ntheme \"nord\"\nmouse_mode true\n"
+	cases := []struct {
+		name string
+		user string
+		want string
+	}{
+		{name: "empty file", user: "", want: team},
+		{name: "user keybinds win", user: "keybinds {\n  unbind \"Ctrl g\"\n}\n", want: "theme \"nord\"\nmouse_mode true\n"},
+		{name: "quoted and annotated names", user: "\"theme\" \"dracula\"\n(bool)mouse_mode false\n", want: "// Prefix key like tmux.\nkeybinds clear-defaults=true {\n  normal { bind \"Ctrl a\" { SwitchToMode \"tmux\"; }; }\n}\n"},
+		{name: "braces in strings and comments", user: "/* keybinds { */\nlayout_dir \"}\" // theme {\n/-theme \"x\"\n", want: team},
+		{name: "everything defined", user: "keybinds {}; theme \"x\"; mouse_mode false\n", want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(missingKDLNodes([]byte(tc.user), []byte(team))); got != tc.want {
+				t.Fatalf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,115 +2,659 @@ package installer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"text/template"
-	"time"
+	"regexp"
+	"strings"
+	"sync"
 
 	"macsetup/configs"
+	"macsetup/internal/config"
+	"macsetup/internal/constants"
 	"macsetup/internal/utils"
 )
 
-type zshrcTemplateData struct {
-	Timestamp string
+// dotfile is one config macsetup manages, with paths expanded.
+type dotfile struct {
+	name     string
+	src      string // in the source's file system
+	dest     string
+	template bool
+	style    config.MergeStyle
+	comment  string // line comment of the format, for block markers
+	// For config.MergeImport: the file the team config is written to, and the
+	// TOML table the import key belongs in.
+	managed string
+	table   string
+	local   string // user-owned sidecar, see config.DotfileSpec
+	format  config.DotfileFormat
 }
 
-func WriteDotfiles() (int, error) {
-	home, err := os.UserHomeDir()
+// dotfileSource is a dotfiles source opened for reading.
+type dotfileSource struct {
+	fsys  fs.FS
+	dir   string // absolute path of a local source, "" otherwise
+	files []dotfile
+	links []config.DotfileLink // with paths expanded
+}
+
+// dotfileClones are the git sources cloned so far, so that listing, planning
+// and writing the dotfiles in one run share a single clone.
+var dotfileClones = struct {
+	sync.Mutex
+	dirs map[config.Asset]string
+}{dirs: make(map[config.Asset]string)}
+
+// cloneDotfiles returns a checkout of the git source src, cloning it the
+// first time it is asked for.
+func cloneDotfiles(ctx context.Context, src config.Asset) (string, error) {
+	dotfileClones.Lock()
+	defer dotfileClones.Unlock()
+	if repo, ok := dotfileClones.dirs[src]; ok {
+		return repo, nil
+	}
+	dir, err := os.MkdirTemp("", "macsetup-dotfiles-*")
+	if err != nil {
+		return "", err
+	}
+	repo := filepath.Join(dir, "repo")
+	if err := GitClone(ctx, src, repo); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to clone dotfiles from %s: %w", src.URL, err)
+	}
+	dotfileClones.dirs[src] = repo
+	return repo, nil
+}
+
+// RemoveDotfileClones deletes the clones of git dotfiles sources made during
+// this run.
+func RemoveDotfileClones() {
+	dotfileClones.Lock()
+	defer dotfileClones.Unlock()
+	for src, repo := range dotfileClones.dirs {
+		_ = os.RemoveAll(filepath.Dir(repo))
+		delete(dotfileClones.dirs, src)
+	}
+}
+
+// openDotfiles opens cfg.Source, or the configs built into macsetup when it
+// has no URL, keeping the files cfg.Files chooses. A git source is cloned once
+// per run, see cloneDotfiles.
+func openDotfiles(ctx context.Context, cfg config.Dotfiles) (*dotfileSource, error) {
+	src := cfg.Source
+	s := &dotfileSource{fsys: configs.FS}
+	switch {
+	case src.URL == "":
+	case isLocalSource(src.URL):
+		dir, err := utils.ExpandHome(src.URL)
+		if err == nil {
+			dir, err = filepath.Abs(dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.fsys, s.dir = os.DirFS(dir), dir
+	default:
+		repo, err := cloneDotfiles(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		s.fsys = os.DirFS(repo)
+	}
+
+	data, err := fs.ReadFile(s.fsys, config.DotfilesManifestName)
+	if err == nil {
+		err = s.load(data)
+	}
+	if err == nil && cfg.Files != nil {
+		err = s.choose(cfg.Files)
+	}
 	if err != nil {
-		return 0, err
-	}
-
-	type fileSpec struct {
-		src       string
-		dest      string
-		mode      os.FileMode
-		isTmpl    bool
-		tmplData  any
-		ensureDir bool
-	}
-
-	files := []fileSpec{
-		{
-			src:       "zshrc.tmpl",
-			dest:      filepath.Join(home, ".zshrc"),
-			mode:      0o644,
-			isTmpl:    true,
-			tmplData:  zshrcTemplateData{Timestamp: time.Now().Format(time.RFC3339)},
-			ensureDir: false,
-		},
-		{
-			src:       "starship.toml",
-			dest:      filepath.Join(home, ".config", "starship", "starship.toml"),
-			mode:      0o644,
-			ensureDir: true,
-		},
-		{
-			src:       "alacritty.toml",
-			dest:      filepath.Join(home, ".config", "alacritty", "alacritty.toml"),
-			mode:      0o644,
-			ensureDir: true,
-		},
-		{
-			src:       "ghostty.conf",
-			dest:      filepath.Join(home, ".config", "ghostty", "config"),
-			mode:      0o644,
-			ensureDir: true,
-		},
-		{
-			src:       "tmux.conf",
-			dest:      filepath.Join(home, ".config", "tmux", "tmux.conf"),
-			mode:      0o644,
-			ensureDir: true,
-		},
-		{
-			src:       "zellij.kdl",
-			dest:      filepath.Join(home, ".config", "zellij", "config.kdl"),
-			mode:      0o644,
-			ensureDir: true,
-		},
-	}
-
-	backups := 0
-	for _, f := range files {
-		if f.ensureDir {
-			if err := os.MkdirAll(filepath.Dir(f.dest), 0o755); err != nil {
-				return backups, err
+		return nil, err
+	}
+	return s, nil
+}
+
+// isLocalSource tells a directory from a git URL.
+func isLocalSource(url string) bool {
+	for _, prefix := range []string{"/", "~", "./", "../"} {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *dotfileSource) load(data []byte) error {
+	manifest, err := config.ParseDotfilesManifest(data)
+	if err != nil {
+		return err
+	}
+	expand := func(path string) string {
+		if err == nil {
+			path, err = utils.ExpandHome(path)
+		}
+		return path
+	}
+	for _, spec := range manifest.Files {
+		f := dotfile{name: spec.Name, src: spec.Src, dest: expand(spec.Dest), template: spec.Template, style: spec.Mode,
+			comment: spec.Comment, table: spec.Table, format: spec.Format}
+		if spec.Managed != "" {
+			f.managed = expand(spec.Managed)
+		}
+		if spec.Local != "" {
+			f.local = expand(spec.Local)
+		}
+		s.files = append(s.files, f)
+	}
+	for _, l := range manifest.Links {
+		s.links = append(s.links, config.DotfileLink{Path: expand(l.Path), Target: expand(l.Target)})
+	}
+	return err
+}
+
+// choose keeps only the named files, and the links pointing at them.
+func (s *dotfileSource) choose(names []string) error {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	var files []dotfile
+	dropped := make(map[string]bool)
+	for _, f := range s.files {
+		if keep[f.name] {
+			files = append(files, f)
+			delete(keep, f.name)
+		} else {
+			dropped[f.dest] = true
+		}
+	}
+	if len(keep) > 0 {
+		var have []string
+		for _, f := range s.files {
+			have = append(have, f.name)
+		}
+		var unknown []string
+		for _, name := range names {
+			if keep[name] {
+				unknown = append(unknown, name)
 			}
 		}
+		return fmt.Errorf("unknown dotfile(s) %s (have %s)", strings.Join(unknown, ", "), strings.Join(have, ", "))
+	}
+	var links []config.DotfileLink
+	for _, l := range s.links {
+		if !dropped[l.Target] {
+			links = append(links, l)
+		}
+	}
+	s.files, s.links = files, links
+	return nil
+}
+
+// DotfileEntry is a file a dotfiles source provides.
+type DotfileEntry struct {
+	Name string
+	Dest string
+}
+
+// ListDotfiles returns every file cfg.Source provides, whatever cfg.Files
+// chooses.
+func ListDotfiles(ctx context.Context, cfg config.Dotfiles) ([]DotfileEntry, error) {
+	cfg.Files = nil
+	src, err := openDotfiles(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]DotfileEntry, 0, len(src.files))
+	for _, f := range src.files {
+		entries = append(entries, DotfileEntry{Name: f.name, Dest: f.dest})
+	}
+	return entries, nil
+}
+
+// DotfileAction is what applying a DotfileChange does to its path.
+type DotfileAction string
+
+const (
+	DotfileCreate    DotfileAction = "create"
+	DotfileUpdate    DotfileAction = "update"
+	DotfileUnchanged DotfileAction = "unchanged"
+	// DotfileSymlink creates a symlink to Target, or repoints one that
+	// planLink may repair.
+	DotfileSymlink DotfileAction = "symlink"
+)
+
+// DotfileChange is the planned outcome for one path WriteDotfiles touches.
+type DotfileChange struct {
+	Path   string
+	Action DotfileAction
+	Old    []byte // current content, nil when the file does not exist
+	New    []byte
+	Target string // for DotfileSymlink
+	// OldTarget is where the symlink being repaired points now. For a
+	// DotfileSymlink with Old set, a file is in the way and is backed up.
+	OldTarget string
+}
+
+// Diff returns a unified diff of the change, or a one-line note for symlinks.
+func (c DotfileChange) Diff() string {
+	switch c.Action {
+	case DotfileSymlink:
+		return fmt.Sprintf("symlink %s -> %s%s\n", c.Path, c.Target, c.replaces())
+	case DotfileCreate:
+		if len(c.New) == 0 {
+			return fmt.Sprintf("create empty %s\n", c.Path)
+		}
+		return utils.UnifiedDiff("/dev/null", c.Path, nil, c.New)
+	default:
+		return utils.UnifiedDiff(c.Path, c.Path, c.Old, c.New)
+	}
+}
+
+// Summary describes the change in one line: the path, the action and, for
+// writes, how many lines are added and removed.
+func (c DotfileChange) Summary() string {
+	switch c.Action {
+	case DotfileSymlink:
+		return fmt.Sprintf("%s: symlink to %s%s", c.Path, c.Target, c.replaces())
+	case DotfileCreate, DotfileUpdate:
+		added, removed := c.Stat()
+		return fmt.Sprintf("%s: %s (+%d -%d)", c.Path, c.Action, added, removed)
+	default:
+		return fmt.Sprintf("%s: %s", c.Path, c.Action)
+	}
+}
+
+// replaces notes what a symlink takes the place of.
+func (c DotfileChange) replaces() string {
+	switch {
+	case c.OldTarget != "":
+		return fmt.Sprintf(" (was -> %s)", c.OldTarget)
+	case c.Old != nil:
+		return " (replacing the file, backed up)"
+	}
+	return ""
+}
 
-		content, err := configs.FS.ReadFile(f.src)
+// Stat returns how many lines the change adds and removes.
+func (c DotfileChange) Stat() (added, removed int) {
+	if c.Action == DotfileSymlink {
+		return 0, 0
+	}
+	return utils.DiffStat(c.Old, c.New)
+}
+
+// PlanDotfiles renders the team configs from cfg.Source with data and
+// compares them with what is on disk, without writing anything. In merge mode only macsetup's
+// block (or import) in each file changes; in replace mode every file is
+// overwritten. Every rendered file is validated first, see validateDotfile.
+// In link mode each file that is not a template becomes a
+// symlink to the team version: the file in a local source itself, or a copy
+// under constants.LinkedDotfilesDir for other sources. Templates are merged.
+func PlanDotfiles(ctx context.Context, cfg config.Dotfiles, data TemplateData) ([]DotfileChange, error) {
+	src, err := openDotfiles(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	replace := cfg.Mode == config.DotfilesReplace
+	link := cfg.Mode == config.DotfilesLink
+	linkDir := src.dir
+	if link && linkDir == "" {
+		home, err := os.UserHomeDir()
 		if err != nil {
-			return backups, err
+			return nil, err
 		}
+		linkDir = filepath.Join(home, constants.LinkedDotfilesDir)
+	}
 
-		if f.isTmpl {
-			tmpl, err := template.New(f.src).Parse(string(content))
+	var plan []DotfileChange
+	add := func(dest string, existing, content []byte) {
+		c := DotfileChange{Path: dest, Old: existing, New: content, Action: DotfileUpdate}
+		switch {
+		case existing == nil:
+			c.Action = DotfileCreate
+		case sameDotfile(existing, content):
+			c.Action = DotfileUnchanged
+		}
+		plan = append(plan, c)
+	}
+
+	for _, f := range src.files {
+		// The team version is checked on its own first, so that its own
+		// mistakes are blamed on the source; planWrite checks the merge.
+		content, err := renderDotfile(src.fsys, f, data)
+		if err == nil {
+			err = validateDotfile(ctx, f.format, content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.src, err)
+		}
+		switch {
+		case link && !f.template:
+			target := filepath.Join(linkDir, filepath.FromSlash(f.src))
+			if src.dir == "" {
+				existing, err := readExisting(target)
+				if err != nil {
+					return nil, err
+				}
+				add(target, existing, content)
+			}
+			c, err := planLink(f.dest, target, true, src.owns)
 			if err != nil {
-				return backups, err
+				return nil, err
 			}
-			var buf bytes.Buffer
-			if err := tmpl.Execute(&buf, f.tmplData); err != nil {
-				return backups, err
+			plan = append(plan, c)
+		default:
+			if err := planWrite(ctx, f, content, replace, add); err != nil {
+				return nil, err
 			}
-			content = buf.Bytes()
 		}
 
-		backup, err := utils.WriteWithBackup(f.dest, content, f.mode)
+		// The sidecar belongs to the user once it exists, so only its
+		// absence is a change.
+		if f.local != "" {
+			if _, err := os.Lstat(f.local); os.IsNotExist(err) {
+				plan = append(plan, DotfileChange{Path: f.local, Action: DotfileCreate, New: []byte{}})
+			}
+		}
+	}
+
+	for _, l := range src.links {
+		c, err := planLink(l.Path, l.Target, link, src.owns)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, c)
+	}
+	return plan, nil
+}
+
+// planWrite plans writing the rendered content of f through add: merged into
+// the user's file, or replacing it. A merged file that would change is
+// checked as a whole, since the user's part has to parse along with the
+// block.
+func planWrite(ctx context.Context, f dotfile, content []byte, replace bool, add func(dest string, existing, content []byte)) error {
+	if !replace && f.style == config.MergeImport {
+		existing, err := readExisting(f.managed)
 		if err != nil {
-			return backups, err
+			return err
+		}
+		add(f.managed, existing, content)
+	}
+	existing, err := readExisting(f.dest)
+	if err != nil {
+		return err
+	}
+	if !replace && f.style != config.MergeOwn {
+		if content, err = mergeDotfile(f, existing, content); err != nil {
+			return fmt.Errorf("%s: %w", f.dest, err)
+		}
+		if existing != nil && !sameDotfile(existing, content) {
+			if err := validateDotfile(ctx, f.format, content); err != nil {
+				return fmt.Errorf("%s with macsetup's block: %w", f.dest, err)
+			}
+		}
+	}
+	add(f.dest, existing, content)
+	return nil
+}
+
+// planLink plans making path a symlink to target. A symlink already there is
+// repaired when it dangles or points at a path macsetup manages (see
+// dotfileSource.owns), since macsetup made it; one the user pointed
+// elsewhere, like anything else at path, is only replaced with takeOver, a
+// file being backed up first.
+func planLink(path, target string, takeOver bool, owned func(string) bool) (DotfileChange, error) {
+	c := DotfileChange{Path: path, Target: target, Action: DotfileSymlink}
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return c, nil
+	case err != nil:
+		return c, err
+	case info.Mode()&os.ModeSymlink != 0:
+		current, err := utils.ReadLink(path)
+		if err != nil {
+			return c, err
+		}
+		switch {
+		case current == target:
+			c.Action = DotfileUnchanged
+		case takeOver, owned(current), !utils.Exists(current):
+			c.OldTarget = current
+		default:
+			c.Action = DotfileUnchanged
+		}
+		return c, nil
+	case !takeOver:
+		c.Action = DotfileUnchanged
+		return c, nil
+	case info.IsDir():
+		return c, fmt.Errorf("%s is a directory, not linking it to %s", path, target)
+	}
+	c.Old, err = os.ReadFile(path)
+	return c, err
+}
+
+// owns reports whether path is somewhere macsetup puts team configs: a file
+// the source writes or links to, or a file inside the source directory or
+// the copy link mode keeps.
+func (s *dotfileSource) owns(path string) bool {
+	dirs := []string{s.dir}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, constants.LinkedDotfilesDir))
+	}
+	for _, dir := range dirs {
+		if dir != "" && strings.HasPrefix(path, dir+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	for _, f := range s.files {
+		if path == f.dest || path == f.managed {
+			return true
 		}
-		if backup != "" {
-			backups++
+	}
+	for _, l := range s.links {
+		if path == l.Target {
+			return true
 		}
 	}
+	return false
+}
 
-	tmuxConf := filepath.Join(home, ".tmux.conf")
-	tmuxTarget := filepath.Join(home, ".config", "tmux", "tmux.conf")
-	if err := utils.SymlinkIfMissing(tmuxConf, tmuxTarget); err != nil {
-		return backups, fmt.Errorf("failed to create tmux symlink: %w", err)
+// volatileLine matches header lines that change on every render, like the
+// generation time in .zshrc.
+var volatileLine = regexp.MustCompile(`(?m)^# Generated at: .*$`)
+
+// sameDotfile reports whether a and b differ only in volatile header lines,
+// so that rendering again does not count as a change.
+func sameDotfile(a, b []byte) bool {
+	return bytes.Equal(volatileLine.ReplaceAll(a, nil), volatileLine.ReplaceAll(b, nil))
+}
+
+// readExisting returns the content of path, or nil when it does not exist.
+func readExisting(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
 	}
+	return content, err
+}
 
-	return backups, nil
+// DotfilesReport is what WriteDotfiles did.
+type DotfilesReport struct {
+	Changes []DotfileChange
+	Backups int // existing files backed up before being rewritten
+}
+
+// Written counts the paths that were created or updated.
+func (r DotfilesReport) Written() int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Action != DotfileUnchanged {
+			n++
+		}
+	}
+	return n
+}
+
+// Message summarises the report for a step result, naming each file by what
+// happened to it, e.g. "updated ~/.zshrc; unchanged ~/.tmux.conf; backed up 1
+// file(s)". A repaired symlink counts as updated.
+func (r DotfilesReport) Message() string {
+	var created, updated, unchanged []string
+	for _, c := range r.Changes {
+		switch {
+		case c.Action == DotfileUpdate, c.Action == DotfileSymlink && (c.OldTarget != "" || c.Old != nil):
+			updated = append(updated, utils.ShortenHome(c.Path))
+		case c.Action == DotfileCreate, c.Action == DotfileSymlink:
+			created = append(created, utils.ShortenHome(c.Path))
+		default:
+			unchanged = append(unchanged, utils.ShortenHome(c.Path))
+		}
+	}
+	var parts []string
+	if len(created) > 0 {
+		parts = append(parts, "created "+strings.Join(created, ", "))
+	}
+	if len(updated) > 0 {
+		parts = append(parts, "updated "+strings.Join(updated, ", "))
+	}
+	if len(unchanged) > 0 {
+		parts = append(parts, "unchanged "+strings.Join(unchanged, ", "))
+	}
+	if r.Backups > 0 {
+		parts = append(parts, fmt.Sprintf("backed up %d file(s)", r.Backups))
+	}
+	if len(parts) == 0 {
+		return "No files selected"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// WriteDotfiles applies PlanDotfiles. Files whose content would not change
+// are neither rewritten nor backed up.
+func WriteDotfiles(ctx context.Context, cfg config.Dotfiles, data TemplateData) (DotfilesReport, error) {
+	var report DotfilesReport
+	plan, err := PlanDotfiles(ctx, cfg, data)
+	if err != nil {
+		return report, err
+	}
+
+	for _, c := range plan {
+		switch c.Action {
+		case DotfileSymlink:
+			if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+				return report, err
+			}
+			if c.OldTarget != "" {
+				if err := relink(c.Path, c.Target); err != nil {
+					return report, fmt.Errorf("failed to repoint symlink %s: %w", c.Path, err)
+				}
+				break
+			}
+			if c.Old != nil {
+				if _, err := moveToBackup(c.Path); err != nil {
+					return report, err
+				}
+				report.Backups++
+			}
+			if err := utils.SetSymlink(c.Path, c.Target); err != nil {
+				return report, fmt.Errorf("failed to create symlink %s: %w", c.Path, err)
+			}
+		case DotfileCreate, DotfileUpdate:
+			if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+				return report, err
+			}
+			backup, err := writeWithBackup(c.Path, c.New, 0o644)
+			if err != nil {
+				return report, err
+			}
+			if backup != "" {
+				report.Backups++
+			}
+		}
+		utils.EmitLine(ctx, fmt.Sprintf("%s: %s", c.Path, c.Action))
+		report.Changes = append(report.Changes, c)
+	}
+	return report, nil
+}
+
+// RemoveDotfiles takes macsetup's blocks and imports out of the user's files,
+// leaving their own content, and returns the files it changed. Files macsetup
+// owns outright are left in place.
+func RemoveDotfiles(ctx context.Context, cfg config.Dotfiles) ([]string, error) {
+	src, err := openDotfiles(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, f := range src.files {
+		if f.style == config.MergeOwn {
+			continue
+		}
+		existing, err := os.ReadFile(f.dest)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		out, removed, err := removeBlock(existing, f.comment)
+		if err != nil {
+			return changed, fmt.Errorf("%s: %w", f.dest, err)
+		}
+		if !removed {
+			continue
+		}
+		if _, err := writeWithBackup(f.dest, out, 0o644); err != nil {
+			return changed, err
+		}
+		changed = append(changed, f.dest)
+		if f.style == config.MergeImport {
+			_ = os.Remove(f.managed)
+		}
+	}
+	return changed, nil
+}
+
+// renderDotfile returns the team version of f, read from fsys and rendered
+// with data when the manifest marks it as a template.
+func renderDotfile(fsys fs.FS, f dotfile, data TemplateData) ([]byte, error) {
+	content, err := fs.ReadFile(fsys, f.src)
+	if err != nil || !f.template {
+		return content, err
+	}
+	return data.render(f.src, content)
+}
+
+// mergeDotfile returns existing with macsetup's part set to content: the
+// content itself as a managed block, or for config.MergeImport a block
+// importing f.managed. A KDL block only carries the top-level nodes the
+// user's part of the file does not define.
+func mergeDotfile(f dotfile, existing, content []byte) ([]byte, error) {
+	if f.style != config.MergeImport {
+		if f.format == config.FormatKDL {
+			user, _, err := removeBlock(existing, f.comment)
+			if err != nil {
+				return nil, err
+			}
+			content = missingKDLNodes(user, content)
+		}
+		return upsertBlock(existing, f.comment, content, len(existing))
+	}
+	// The import has to go inside f.table. If the user's file has that table,
+	// the block goes right under its header; otherwise it opens with a
+	// dotted key at the top, before any table.
+	header := regexp.MustCompile(`(?m)^[ \t]*\[` + regexp.QuoteMeta(f.table) + `\][ \t]*(#.*)?(\r?\n|\z)`)
+	if loc := header.FindIndex(existing); loc != nil {
+		body := fmt.Sprintf("import = [%q]\n", f.managed)
+		return upsertBlock(existing, f.comment, []byte(body), loc[1])
+	}
+	body := fmt.Sprintf("%s.import = [%q]\n", f.table, f.managed)
+	return upsertBlock(existing, f.comment, []byte(body), 0)
 }
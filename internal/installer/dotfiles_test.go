@@ -0,0 +1,458 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"macsetup/internal/config"
+	"macsetup/internal/constants"
+)
+
+func TestMergeImport(t *testing.T) {
+	f := dotfile{style: config.MergeImport, comment: "#", managed: "/home/u/.config/alacritty/macsetup.toml", table: "general"}
+	cases := []struct {
+		name     string
+		existing string
+		want     []string // in order
+	}{
+		{
+			name:     "no general table",
+			existing: "[font]\nsize = 14.0\n",
+			want:     []string{`general.import = ["/home/u/.config/alacritty/macsetup.toml"]`, "[font]"},
+		},
+		{
+			name:     "existing general table",
+			existing: "[font]\nsize = 14.0\n\n[general]\nlive_config_reload = true\n",
+			want:     []string{"[font]", "[general]", `import = ["/home/u/.config/alacritty/macsetup.toml"]`, "live_config_reload"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mergeDotfile(f, []byte(tc.existing), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rest := string(got)
+			for _, w := range tc.want {
+				i := strings.Index(rest, w)
+				if i < 0 {
+					t.Fatalf("%q missing or out of order in:\n%s", w, got)
+				}
+				rest = rest[i+len(w):]
+			}
+		})
+	}
+}
+
+func TestWriteDotfilesMergeKeepsUserContent(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	tmuxConf := filepath.Join(home, ".config", "tmux", "tmux.conf")
+	if err := os.MkdirAll(filepath.Dir(tmuxConf), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	user := "set -g history-limit 50000\n"
+	if err := os.WriteFile(tmuxConf, []byte(user), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WriteDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesMerge}, TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(tmuxConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), user) || !strings.Contains(string(got), blockBegin) {
+		t.Fatalf("user content lost or block missing:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".config", "alacritty", "macsetup.toml")); err != nil {
+		t.Fatalf("alacritty team config not written: %v", err)
+	}
+
+	if _, err := RemoveDotfiles(context.Background(), config.Dotfiles{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = os.ReadFile(tmuxConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != user {
+		t.Fatalf("after remove: got %q want %q", got, user)
+	}
+}
+
+func TestPlanDotfilesWritesNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	plan, err := PlanDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesMerge}, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range plan {
+		want := DotfileCreate
+		if c.Path == filepath.Join(home, ".tmux.conf") {
+			want = DotfileSymlink
+		}
+		if c.Action != want {
+			t.Fatalf("%s: got %s want %s", c.Path, c.Action, want)
+		}
+		if _, err := os.Lstat(c.Path); !os.IsNotExist(err) {
+			t.Fatalf("%s exists after planning", c.Path)
+		}
+	}
+
+	if _, err := WriteDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesMerge}, TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = PlanDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesMerge}, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range plan {
+		if c.Action != DotfileUnchanged {
+			t.Fatalf("%s: %s after writing", c.Path, c.Action)
+		}
+	}
+}
+
+func TestPlanDotfilesValidatesMergedFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	alacritty := filepath.Join(home, ".config", "alacritty", "alacritty.toml")
+	if err := os.MkdirAll(filepath.Dir(alacritty), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(alacritty, []byte("[font]\nsize = \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := PlanDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesMerge, Files: []string{"alacritty"}}, TemplateData{})
+	if err == nil || !strings.Contains(err.Error(), alacritty) {
+		t.Fatalf("got %v, want an error naming %s", err, alacritty)
+	}
+}
+
+func TestWriteDotfilesSkipsUnchanged(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	zshrc := filepath.Join(home, ".zshrc")
+
+	first, err := WriteDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesReplace}, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Written() != len(first.Changes) || first.Backups != 0 {
+		t.Fatalf("first run: %s", first.Message())
+	}
+	// Only the generation timestamp differs from a fresh render.
+	content, err := os.ReadFile(zshrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := volatileLine.ReplaceAll(content, []byte("# Generated at: 2001-01-01T00:00:00Z"))
+	if err := os.WriteFile(zshrc, stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := WriteDotfiles(context.Background(), config.Dotfiles{Mode: config.DotfilesReplace}, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Written() != 0 || second.Backups != 0 {
+		t.Fatalf("second run rewrote files: %s", second.Message())
+	}
+	if got, _ := os.ReadFile(zshrc); !bytes.Equal(got, stale) {
+		t.Fatal(".zshrc rewritten for a timestamp change")
+	}
+	backups, _ := filepath.Glob(zshrc + ".bak.*")
+	if len(backups) != 0 {
+		t.Fatalf("unexpected backups: %v", backups)
+	}
+}
+
+func TestLocalDotfilesSource(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	src := t.TempDir()
+	files := map[string]string{
+		"dotfiles.json": `{"files": [
+			{"src": "tmux.conf", "dest": "~/.config/tmux/tmux.conf", "comment": "#"},
+			{"src": "gitconfig", "dest": "~/.gitconfig.team", "mode": "own"}
+		]}`,
+		"tmux.conf": "set -g mouse on\n",
+		"gitconfig": "[pull]\n\trebase = true\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Dotfiles{Mode: config.DotfilesMerge, Source: config.Asset{URL: src}}
+	report, err := WriteDotfiles(context.Background(), cfg, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 2 {
+		t.Fatalf("got %d changes, want the 2 files in the manifest: %s", len(report.Changes), report.Message())
+	}
+	tmux, _ := os.ReadFile(filepath.Join(home, ".config", "tmux", "tmux.conf"))
+	if !strings.Contains(string(tmux), "set -g mouse on") || !strings.Contains(string(tmux), blockBegin) {
+		t.Fatalf("tmux.conf not merged from the source:\n%s", tmux)
+	}
+	if got, _ := os.ReadFile(filepath.Join(home, ".gitconfig.team")); string(got) != files["gitconfig"] {
+		t.Fatalf("extra file: got %q", got)
+	}
+	// Nothing from the built-in set is written.
+	if _, err := os.Stat(filepath.Join(home, ".zshrc")); !os.IsNotExist(err) {
+		t.Fatal("built-in .zshrc written for a custom source")
+	}
+}
+
+func TestLocalSidecarsCreatedOnce(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := config.Dotfiles{Mode: config.DotfilesReplace}
+	local := filepath.Join(home, ".zshrc.local")
+
+	if _, err := WriteDotfiles(context.Background(), cfg, TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(local); err != nil || len(got) != 0 {
+		t.Fatalf("sidecar not created empty: %q, %v", got, err)
+	}
+	zshrc, _ := os.ReadFile(filepath.Join(home, ".zshrc"))
+	if !strings.Contains(string(zshrc), "source ~/.zshrc.local") {
+		t.Fatal(".zshrc does not source the sidecar")
+	}
+
+	mine := "export AWS_PROFILE=dev\n"
+	if err := os.WriteFile(local, []byte(mine), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanDotfiles(context.Background(), cfg, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range plan {
+		if c.Path == local {
+			t.Fatalf("edited sidecar in the plan as %s", c.Action)
+		}
+	}
+	if _, err := WriteDotfiles(context.Background(), cfg, TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != mine {
+		t.Fatalf("sidecar overwritten: %q", got)
+	}
+}
+
+func TestChooseDotfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	tmuxLink := filepath.Join(home, ".tmux.conf")
+
+	cases := []struct {
+		name      string
+		files     []string
+		wantDests []string
+		wantLink  bool
+		wantErr   bool
+	}{
+		{name: "all", files: nil, wantDests: []string{".zshrc", ".config/tmux/tmux.conf", ".config/zellij/config.kdl"}, wantLink: true},
+		{name: "tmux only", files: []string{"tmux"}, wantDests: []string{".config/tmux/tmux.conf"}, wantLink: true},
+		{name: "without tmux", files: []string{"zshrc", "starship"}, wantDests: []string{".zshrc", ".config/starship/starship.toml"}},
+		{name: "none", files: []string{}},
+		{name: "unknown", files: []string{"vimrc"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := PlanDotfiles(context.Background(), config.Dotfiles{Files: tc.files}, TemplateData{})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths := make(map[string]bool)
+			for _, c := range plan {
+				paths[c.Path] = true
+			}
+			for _, d := range tc.wantDests {
+				if !paths[filepath.Join(home, d)] {
+					t.Errorf("%s not in the plan", d)
+				}
+			}
+			if paths[tmuxLink] != tc.wantLink {
+				t.Errorf("~/.tmux.conf in plan: %v, want %v", paths[tmuxLink], tc.wantLink)
+			}
+			if tc.files != nil && len(tc.files) == 0 && len(plan) != 0 {
+				t.Errorf("plan for no files has %d changes", len(plan))
+			}
+		})
+	}
+}
+
+func TestLinkMode(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	src := t.TempDir()
+	files := map[string]string{
+		"dotfiles.json": `{"files": [
+			{"name": "starship", "src": "starship.toml", "dest": "~/.config/starship/starship.toml", "mode": "own"},
+			{"name": "zshrc", "src": "zshrc", "dest": "~/.zshrc", "template": true, "comment": "#"}
+		]}`,
+		"starship.toml": "add_newline = false\n",
+		"zshrc":         "export EDITOR={{default \"vi\" .Vars.editor}}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	starship := filepath.Join(home, ".config", "starship", "starship.toml")
+	if err := os.MkdirAll(filepath.Dir(starship), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(starship, []byte("mine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		source     string
+		files      []string
+		wantTarget string
+	}{
+		{name: "local source", source: src, wantTarget: filepath.Join(src, "starship.toml")},
+		// Repoints the link made above at the copy macsetup keeps.
+		{name: "built-in source", files: []string{"starship"}, wantTarget: filepath.Join(home, ".local", "share", "macsetup", "dotfiles", "starship.toml")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.Dotfiles{Mode: config.DotfilesLink, Source: config.Asset{URL: tc.source}, Files: tc.files}
+			if _, err := WriteDotfiles(context.Background(), cfg, TemplateData{}); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := os.Readlink(starship); err != nil || got != tc.wantTarget {
+				t.Fatalf("starship.toml links to %q (%v), want %q", got, err, tc.wantTarget)
+			}
+			plan, err := PlanDotfiles(context.Background(), cfg, TemplateData{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range plan {
+				if c.Action != DotfileUnchanged {
+					t.Fatalf("second run plans %s", c.Summary())
+				}
+			}
+		})
+	}
+
+	// The user's own file was backed up, not lost, and the repointed link
+	// was recorded.
+	backups, err := LoadBackups()
+	if err != nil || len(backups) != 2 || backups[0].Target != starship {
+		t.Fatalf("backups: %+v, %v", backups, err)
+	}
+	if got, _ := os.ReadFile(backups[0].Path); string(got) != "mine\n" {
+		t.Fatalf("backup holds %q", got)
+	}
+	if want := filepath.Join(src, "starship.toml"); backups[1].OldTarget != want {
+		t.Fatalf("repoint recorded as %+v, want the old target %s", backups[1], want)
+	}
+	// A template is still rendered into a file of its own.
+	if info, err := os.Lstat(filepath.Join(home, ".zshrc")); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf(".zshrc should be a rendered file: %v", err)
+	}
+	// Edits through the link land in the source.
+	cfg := config.Dotfiles{Mode: config.DotfilesLink, Source: config.Asset{URL: src}}
+	if _, err := WriteDotfiles(context.Background(), cfg, TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(starship, []byte("add_newline = true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(src, "starship.toml")); string(got) != "add_newline = true\n" {
+		t.Fatalf("edit did not reach the source: %q", got)
+	}
+}
+
+func TestDotfilesReportMessage(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	report := DotfilesReport{Backups: 1, Changes: []DotfileChange{
+		{Path: filepath.Join(home, ".zshrc"), Action: DotfileUpdate},
+		{Path: filepath.Join(home, ".config/tmux/tmux.conf"), Action: DotfileUnchanged},
+		{Path: filepath.Join(home, ".config/zellij/config.kdl"), Action: DotfileCreate},
+		{Path: filepath.Join(home, ".tmux.conf"), Action: DotfileSymlink, OldTarget: "/elsewhere"},
+		{Path: "/etc/zshrc", Action: DotfileUnchanged},
+	}}
+	want := "created ~/.config/zellij/config.kdl; updated ~/.zshrc, ~/.tmux.conf; " +
+		"unchanged ~/.config/tmux/tmux.conf, /etc/zshrc; backed up 1 file(s)"
+	if got := report.Message(); got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestLinksRepairedOnlyWhenManaged(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	tmuxConf := filepath.Join(home, ".config", "tmux", "tmux.conf")
+	mine := filepath.Join(home, "dotfiles", "tmux.conf")
+	for _, path := range []string{tmuxConf, mine} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("set -g mouse on\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(home, ".tmux.conf")
+
+	cases := []struct {
+		name       string
+		oldTarget  string
+		mode       config.DotfilesMode
+		wantTarget string
+	}{
+		{name: "user's own link", oldTarget: mine, mode: config.DotfilesMerge, wantTarget: mine},
+		{name: "dangling", oldTarget: filepath.Join(home, "gone"), mode: config.DotfilesMerge, wantTarget: tmuxConf},
+		{name: "into the link-mode copy", oldTarget: filepath.Join(home, constants.LinkedDotfilesDir, "tmux.conf"), mode: config.DotfilesMerge, wantTarget: tmuxConf},
+		{name: "user's own link in link mode", oldTarget: mine, mode: config.DotfilesLink, wantTarget: tmuxConf},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.Remove(link)
+			if err := os.Symlink(tc.oldTarget, link); err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.Dotfiles{Mode: tc.mode, Files: []string{"tmux"}}
+			if _, err := WriteDotfiles(context.Background(), cfg, TemplateData{}); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.Readlink(link); got != tc.wantTarget {
+				t.Fatalf("~/.tmux.conf -> %s, want %s", got, tc.wantTarget)
+			}
+			if tc.wantTarget == tc.oldTarget {
+				return
+			}
+			// The old target is in the index, and restoring puts it back.
+			if _, err := RestoreBackup(link, ""); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.Readlink(link); got != tc.oldTarget {
+				t.Fatalf("restored ~/.tmux.conf -> %s, want %s", got, tc.oldTarget)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// downloadAsset fetches asset.URL to dest and verifies its pinned SHA-256, if
+// any. A mismatching file is removed so it can never be executed.
+func downloadAsset(ctx context.Context, verbose bool, asset config.Asset, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	if err := utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
+		res, err := utils.Run(ctx, verbose, 0, "curl", "-fsSL", "-o", dest, asset.URL)
+		if err != nil {
+			if strings.TrimSpace(res.Stderr) != "" {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := utils.VerifySHA256(dest, asset.URL, asset.SHA256); err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return nil
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 
 	"macsetup/internal/config"
+	"macsetup/internal/utils"
 )
 
-func DryRunPlan(ctx context.Context, selected map[string]bool) []string {
+func DryRunPlan(ctx context.Context, selected map[string]bool, opts RunOptions) []string {
 	var lines []string
 
-	if IsXcodeInstalled(ctx) {
+	if !utils.IsMacOS() {
+		lines = append(lines, "Xcode CLI Tools: not needed on Linux (skip)")
+	} else if IsXcodeInstalled(ctx) {
 		lines = append(lines, "Xcode CLI Tools: already installed (skip)")
 	} else {
 		lines = append(lines, "Xcode CLI Tools: would install (GUI prompt)")
@@ -35,16 +38,30 @@ func DryRunPlan(ctx context.Context, selected map[string]bool) []string {
 			lines = append(lines, "  - "+formatDryRunTap(ctx, brewInstalled, name))
 		}
 	}
+	if (len(formulas) > 0 || len(casks) > 0) && opts.Bundle == nil {
+		lines = append(lines, "Prefetch: would run brew fetch for missing formulas and casks in parallel (--workers)")
+	}
 	if len(formulas) > 0 {
-		lines = append(lines, fmt.Sprintf("Formulas (parallel): %d", len(formulas)))
+		if opts.Batch {
+			lines = append(lines, fmt.Sprintf("Formulas (one brew install, failures retried singly): %d", len(formulas)))
+		} else {
+			lines = append(lines, fmt.Sprintf("Formulas (installed one at a time): %d", len(formulas)))
+		}
 		for _, f := range formulas {
 			lines = append(lines, "  - "+formatDryRunBrewPkg(ctx, brewInstalled, f))
 		}
 	}
-	if len(casks) > 0 {
-		lines = append(lines, fmt.Sprintf("Casks (sequential): %d", len(casks)))
+	if len(casks) > 0 && !utils.IsMacOS() {
+		lines = append(lines, fmt.Sprintf("Casks: %d skipped (not supported on Linux)", len(casks)))
+	} else if len(casks) > 0 {
+		if opts.Batch {
+			lines = append(lines, fmt.Sprintf("Casks (one brew install, failures retried singly): %d", len(casks)))
+		} else {
+			lines = append(lines, fmt.Sprintf("Casks (sequential): %d", len(casks)))
+		}
+		infos := newCaskInfos()
 		for _, c := range casks {
-			lines = append(lines, "  - "+formatDryRunBrewPkg(ctx, brewInstalled, c))
+			lines = append(lines, "  - "+formatDryRunCask(ctx, infos, brewInstalled, c, opts))
 		}
 	}
 
@@ -54,7 +71,17 @@ func DryRunPlan(ctx context.Context, selected map[string]bool) []string {
 	lines = append(lines, "  - Neovim config (skip if ~/.config/nvim exists)")
 	lines = append(lines, "  - TPM (tmux plugins)")
 	lines = append(lines, "  - Mise runtimes (node/python/go)")
-	lines = append(lines, "  - Write dotfiles (with backups)")
+	switch opts.Dotfiles.Mode {
+	case config.DotfilesReplace:
+		lines = append(lines, "  - Write dotfiles (replacing each file, with backups)")
+	case config.DotfilesLink:
+		lines = append(lines, "  - Write dotfiles (symlinks to the team files, templates merged, with backups)")
+	default:
+		lines = append(lines, "  - Write dotfiles (managed blocks only, with backups)")
+	}
+	if src := opts.Dotfiles.Source; src.URL != "" {
+		lines = append(lines, "    - from "+formatAsset(src))
+	}
 	lines = append(lines, "  - Configure fzf (skip if already configured)")
 	return lines
 }
@@ -86,3 +113,30 @@ func formatDryRunBrewPkg(ctx context.Context, brewInstalled bool, pkg config.Pac
 	}
 	return fmt.Sprintf("%s (%s): would install", pkg.Name, pkg.Type)
 }
+
+func formatDryRunCask(ctx context.Context, infos *caskInfos, brewInstalled bool, pkg config.Package, opts RunOptions) string {
+	if brewInstalled {
+		if ok, err := IsBrewPackageInstalled(ctx, false, pkg); err == nil && ok {
+			return fmt.Sprintf("%s (%s): already installed (skip)", pkg.Name, pkg.Type)
+		}
+	}
+	app, exists := infos.findApp(ctx, false, pkg)
+	if !exists {
+		return formatDryRunBrewPkg(ctx, brewInstalled, pkg)
+	}
+	switch opts.AdoptPolicyFor(pkg) {
+	case config.AdoptAdopt:
+		return fmt.Sprintf("%s (%s): app exists at %s, would adopt into Homebrew", pkg.Name, pkg.Type, app.Path)
+	case config.AdoptReplace:
+		return fmt.Sprintf("%s (%s): app exists at %s, would replace with cask", pkg.Name, pkg.Type, app.Path)
+	default:
+		return fmt.Sprintf("%s (%s): app exists at %s (skip)", pkg.Name, pkg.Type, app.Path)
+	}
+}
+
+func formatAsset(a config.Asset) string {
+	if a.Ref != "" {
+		return fmt.Sprintf("%s (ref %s)", a.URL, a.Ref)
+	}
+	return a.URL
+}
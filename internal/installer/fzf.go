@@ -20,15 +20,7 @@ func ConfigureFzf(ctx context.Context) (InstallStatus, error) {
 	if _, err := utils.Run(ctx, false, 0, brewCmd, "list", "--formula", "fzf"); err != nil {
 		return StatusSkipped, nil
 	}
-	res, err := utils.Run(ctx, false, 0, brewCmd, "--prefix")
-	if err != nil {
-		return StatusFailed, err
-	}
-	prefix := res.Stdout
-	for len(prefix) > 0 && (prefix[len(prefix)-1] == '\n' || prefix[len(prefix)-1] == '\r') {
-		prefix = prefix[:len(prefix)-1]
-	}
-	installScript := filepath.Join(prefix, "opt", "fzf", "install")
+	installScript := filepath.Join(BrewPrefix(ctx), "opt", "fzf", "install")
 	_, err = utils.Run(ctx, false, 0, installScript, "--all", "--no-bash", "--no-fish")
 	if err != nil {
 		return StatusFailed, err
@@ -8,11 +8,11 @@ import (
 	"strings"
 	"time"
 
-	"macsetup/internal/constants"
+	"macsetup/internal/config"
 	"macsetup/internal/utils"
 )
 
-func CloneNeovimConfig(ctx context.Context) (InstallStatus, error) {
+func CloneNeovimConfig(ctx context.Context, repo config.Asset) (InstallStatus, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return StatusFailed, err
@@ -21,13 +21,13 @@ func CloneNeovimConfig(ctx context.Context) (InstallStatus, error) {
 	if utils.Exists(dest) {
 		return StatusSkipped, nil
 	}
-	if err := GitClone(ctx, constants.KickstartNvimURL, dest); err != nil {
+	if err := GitClone(ctx, repo, dest); err != nil {
 		return StatusFailed, err
 	}
 	return StatusInstalled, nil
 }
 
-func CloneTPM(ctx context.Context) (InstallStatus, error) {
+func CloneTPM(ctx context.Context, repo config.Asset) (InstallStatus, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return StatusFailed, err
@@ -36,15 +36,24 @@ func CloneTPM(ctx context.Context) (InstallStatus, error) {
 	if utils.Exists(dest) {
 		return StatusSkipped, nil
 	}
-	if err := GitClone(ctx, constants.TpmURL, dest); err != nil {
+	if err := GitClone(ctx, repo, dest); err != nil {
 		return StatusFailed, err
 	}
 	return StatusInstalled, nil
 }
 
-func GitClone(ctx context.Context, url, dest string) error {
-	return utils.Retry(ctx, false, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
-		res, err := utils.Run(ctx, false, 0, "git", "clone", url, dest)
+// GitClone clones repo into dest. A pinned ref is resolved before anything
+// is checked out; if it does not exist the clone is removed and an
+// IntegrityError returned.
+func GitClone(ctx context.Context, repo config.Asset, dest string) error {
+	// --progress keeps git talking without a terminal, so a slow clone is
+	// not mistaken for a stalled one.
+	args := []string{"clone", "--progress", repo.URL, dest}
+	if repo.Ref != "" {
+		args = []string{"clone", "--progress", "--no-checkout", repo.URL, dest}
+	}
+	if err := utils.Retry(ctx, false, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
+		res, err := utils.Run(ctx, false, 0, "git", args...)
 		if err != nil {
 			if strings.TrimSpace(res.Stderr) != "" {
 				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
@@ -52,5 +61,37 @@ func GitClone(ctx context.Context, url, dest string) error {
 			return err
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	if repo.Ref == "" {
+		return nil
+	}
+
+	commit, err := resolveRef(ctx, dest, repo)
+	if err == nil {
+		var res utils.CmdResult
+		res, err = utils.Run(ctx, false, 30*time.Second, "git", "-C", dest, "checkout", "--quiet", "--detach", commit)
+		if err != nil && strings.TrimSpace(res.Stderr) != "" {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+		}
+	}
+	if err != nil {
+		// Leave nothing behind that a later run would mistake for an install.
+		_ = os.RemoveAll(dest)
+		return err
+	}
+	return nil
+}
+
+// resolveRef returns the commit repo.Ref names in the repository at dir. Tags
+// and commits resolve directly, other branches through origin/.
+func resolveRef(ctx context.Context, dir string, repo config.Asset) (string, error) {
+	for _, name := range []string{repo.Ref, "origin/" + repo.Ref} {
+		res, err := utils.Run(ctx, false, 10*time.Second, "git", "-C", dir, "rev-parse", "--verify", "--quiet", name+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(res.Stdout), nil
+		}
+	}
+	return "", &utils.IntegrityError{Source: repo.URL, Want: "ref " + repo.Ref, Got: "no such ref"}
 }
@@ -0,0 +1,91 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// initTestRepo creates a repository with two commits and a tag on the first.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "--quiet")
+	for i, content := range []string{"v1\n", "v2\n"} {
+		if err := os.WriteFile(filepath.Join(dir, "VERSION"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "VERSION")
+		git("commit", "--quiet", "-m", content)
+		if i == 0 {
+			git("tag", "v1")
+		}
+	}
+	return dir
+}
+
+func TestGitClonePinnedRef(t *testing.T) {
+	repo := initTestRepo(t)
+	dest := filepath.Join(t.TempDir(), "clone")
+
+	if err := GitClone(context.Background(), config.Asset{URL: repo, Ref: "v1"}, dest); err != nil {
+		t.Fatalf("GitClone: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "VERSION"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1\n" {
+		t.Fatalf("checked out %q, want the tagged v1", data)
+	}
+}
+
+func TestGitCloneMissingRef(t *testing.T) {
+	repo := initTestRepo(t)
+	dest := filepath.Join(t.TempDir(), "clone")
+
+	err := GitClone(context.Background(), config.Asset{URL: repo, Ref: "v9"}, dest)
+	var ie *utils.IntegrityError
+	if !errors.As(err, &ie) {
+		t.Fatalf("expected IntegrityError, got %v", err)
+	}
+	if utils.Exists(dest) {
+		t.Fatalf("clone left behind after a failed pin check")
+	}
+}
+
+func TestCloneDotfilesOnce(t *testing.T) {
+	src := config.Asset{URL: "file://" + initTestRepo(t)}
+	first, err := cloneDotfiles(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cloneDotfiles(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatalf("cloned twice: %s and %s", first, second)
+	}
+	RemoveDotfileClones()
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Fatalf("clone left behind: %v", err)
+	}
+}
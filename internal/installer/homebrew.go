@@ -7,22 +7,17 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"macsetup/internal/config"
-	"macsetup/internal/constants"
 	"macsetup/internal/utils"
 )
 
-// brewMutex ensures only one brew command runs at a time to avoid Homebrew's file locking issues
-var brewMutex sync.Mutex
-
 func GetBrewExecutable() string {
 	if path, err := exec.LookPath("brew"); err == nil {
 		return path
 	}
-	return "/opt/homebrew/bin/brew"
+	return filepath.Join(installedBrewPrefix(), "bin", "brew")
 }
 
 func IsBrewInstalled(ctx context.Context, verbose bool) bool {
@@ -31,14 +26,11 @@ func IsBrewInstalled(ctx context.Context, verbose bool) bool {
 	return err == nil
 }
 
-func InstallBrew(ctx context.Context, verbose bool) error {
+func InstallBrew(ctx context.Context, verbose bool, installScript config.Asset) error {
 	dir := os.TempDir()
 	script := filepath.Join(dir, "macsetup-homebrew-install.sh")
 
-	if err := utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
-		_, err := utils.Run(ctx, verbose, 0, "curl", "-fsSL", "-o", script, constants.HomebrewInstallScriptURL)
-		return err
-	}); err != nil {
+	if err := downloadAsset(ctx, verbose, installScript, script); err != nil {
 		return err
 	}
 	defer func() {
@@ -52,39 +44,45 @@ func InstallBrew(ctx context.Context, verbose bool) error {
 	if err := cmd.Run(); err != nil {
 		return err
 	}
+	binDir := filepath.Join(BrewPrefix(ctx), "bin")
 	path := os.Getenv("PATH")
-	if !strings.Contains(path, "/opt/homebrew/bin") {
-		_ = os.Setenv("PATH", "/opt/homebrew/bin:"+path)
+	if !strings.Contains(path, binDir) {
+		_ = os.Setenv("PATH", binDir+":"+path)
 	}
 	return nil
 }
 
 func BrewUpdate(ctx context.Context, verbose bool) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 300 * time.Millisecond}, func(ctx context.Context) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 300 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
 		_, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "update")
 		return err
 	})
 }
 
 func BrewUpgrade(ctx context.Context, verbose bool) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 300 * time.Millisecond}, func(ctx context.Context) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 300 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
 		_, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "upgrade")
 		return err
 	})
 }
 
-func AddTap(ctx context.Context, verbose bool, tap string) error {
+// AddTap taps tap, cloning it from remote when given instead of GitHub.
+func AddTap(ctx context.Context, verbose bool, tap, remote string) error {
 	if tap == "" {
 		return nil
 	}
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 300 * time.Millisecond}, func(ctx context.Context) error {
-		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "tap", tap)
+	args := []string{"tap", tap}
+	if remote != "" {
+		args = append(args, remote)
+	}
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 300 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
+		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), args...)
 		if err != nil {
 			if strings.TrimSpace(res.Stderr) != "" {
 				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
@@ -99,6 +97,8 @@ func IsTapInstalled(ctx context.Context, verbose bool, tap string) (bool, error)
 	if tap == "" {
 		return true, nil
 	}
+	ctx, release := resources.Acquire(ctx, ReadLock(ResBrew))
+	defer release()
 	res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "tap")
 	if err != nil {
 		return false, err
@@ -112,9 +112,9 @@ func IsTapInstalled(ctx context.Context, verbose bool, tap string) (bool, error)
 }
 
 func InstallFormula(ctx context.Context, verbose bool, name string) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
 		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "install", name)
 		if err != nil {
 			if strings.TrimSpace(res.Stderr) != "" {
@@ -126,9 +126,14 @@ func InstallFormula(ctx context.Context, verbose bool, name string) error {
 	})
 }
 
+// LinkFormula links an installed formula into the brew prefix. Keg-only formulas
+// are left alone and reported with ErrKegOnly.
 func LinkFormula(ctx context.Context, verbose bool, name string) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
+	if FormulaLinkState(ctx, verbose, name) == LinkKegOnly {
+		return fmt.Errorf("%w: %s", ErrKegOnly, name)
+	}
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
 	res, err := utils.Run(ctx, verbose, 10*time.Second, GetBrewExecutable(), "link", "--overwrite", name)
 	if err != nil {
 		// Check if it's already linked
@@ -144,9 +149,9 @@ func LinkFormula(ctx context.Context, verbose bool, name string) error {
 }
 
 func ReinstallFormula(ctx context.Context, verbose bool, name string) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
 		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "reinstall", name)
 		if err != nil {
 			if strings.TrimSpace(res.Stderr) != "" {
@@ -159,9 +164,9 @@ func ReinstallFormula(ctx context.Context, verbose bool, name string) error {
 }
 
 func InstallCask(ctx context.Context, verbose bool, name string) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
 		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "install", "--cask", name)
 		if err != nil {
 			if strings.TrimSpace(res.Stderr) != "" {
@@ -173,10 +178,97 @@ func InstallCask(ctx context.Context, verbose bool, name string) error {
 	})
 }
 
+// InstallBatch installs several formulas, or casks, with a single
+// `brew install` and returns brew's combined output for per-package parsing.
+// It does not retry; callers fall back to single installs for failures.
+func InstallBatch(ctx context.Context, verbose, cask bool, names []string) (string, error) {
+	args := []string{"install", "--formula"}
+	if cask {
+		args = []string{"install", "--cask"}
+	}
+	args = append(args, names...)
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), args...)
+	return res.Stdout + "\n" + res.Stderr, err
+}
+
+// CachedDownload returns where Homebrew keeps the download of a formula's
+// bottle or a cask's artifact.
+func CachedDownload(ctx context.Context, verbose bool, pkg config.Package) (string, error) {
+	flag := "--formula"
+	if pkg.Type == config.TypeCask {
+		flag = "--cask"
+	}
+	ctx, release := resources.Acquire(ctx, ReadLock(ResBrew))
+	defer release()
+	res, err := utils.Run(ctx, verbose, 30*time.Second, GetBrewExecutable(), "--cache", flag, pkg.Name)
+	if err != nil {
+		if strings.TrimSpace(res.Stderr) != "" {
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// FetchPackage downloads a formula (with its dependencies) or a cask into
+// Homebrew's cache without installing it. Fetches only read the installation
+// and write to the download cache, so several can run at once.
+func FetchPackage(ctx context.Context, verbose bool, pkg config.Package) error {
+	ctx, release := resources.Acquire(ctx, ReadLock(ResBrew))
+	defer release()
+	args := []string{"fetch"}
+	switch pkg.Type {
+	case config.TypeFormula:
+		args = append(args, "--formula", "--deps", pkg.Name)
+	case config.TypeCask:
+		args = append(args, "--cask", pkg.Name)
+	default:
+		return nil
+	}
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 2, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
+		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), args...)
+		if err != nil {
+			if strings.TrimSpace(res.Stderr) != "" {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// AdoptCask installs a cask over an app that is already present, taking it
+// under Homebrew management instead of failing on the existing bundle.
+func AdoptCask(ctx context.Context, verbose bool, name string) error {
+	return installCaskWith(ctx, verbose, name, "--adopt")
+}
+
+// ReplaceCask installs a cask, overwriting an app that is already present.
+func ReplaceCask(ctx context.Context, verbose bool, name string) error {
+	return installCaskWith(ctx, verbose, name, "--force")
+}
+
+func installCaskWith(ctx context.Context, verbose bool, name, flag string) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
+		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "install", "--cask", flag, name)
+		if err != nil {
+			if strings.TrimSpace(res.Stderr) != "" {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
+			}
+			return err
+		}
+		return nil
+	})
+}
+
 func ReinstallCask(ctx context.Context, verbose bool, name string) error {
-	brewMutex.Lock()
-	defer brewMutex.Unlock()
-	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	defer release()
+	return utils.Retry(ctx, verbose, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond, Classify: utils.RetryTransient}, func(ctx context.Context) error {
 		res, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "reinstall", "--cask", name)
 		if err != nil {
 			if strings.TrimSpace(res.Stderr) != "" {
@@ -189,6 +281,8 @@ func ReinstallCask(ctx context.Context, verbose bool, name string) error {
 }
 
 func IsBrewPackageInstalled(ctx context.Context, verbose bool, pkg config.Package) (bool, error) {
+	ctx, release := resources.Acquire(ctx, ReadLock(ResBrew))
+	defer release()
 	switch pkg.Type {
 	case config.TypeFormula:
 		_, err := utils.Run(ctx, verbose, 0, GetBrewExecutable(), "list", "--formula", pkg.Name)
@@ -201,48 +295,7 @@ func IsBrewPackageInstalled(ctx context.Context, verbose bool, pkg config.Packag
 	}
 }
 
-// IsCaskAppInstalled checks if a cask's app exists in /Applications
-// This detects manually-installed apps that aren't managed by Homebrew
-func IsCaskAppInstalled(caskName string) (bool, string) {
-	// Map common cask names to their .app names
-	caskToApp := map[string]string{
-		"iterm2":    "iTerm.app",
-		"raycast":   "Raycast.app",
-		"rectangle": "Rectangle.app",
-		"alacritty": "Alacritty.app",
-		"ghostty":   "Ghostty.app",
-		"docker":    "Docker.app",
-		"slack":     "Slack.app",
-		"zoom":      "zoom.us.app",
-		"postman":   "Postman.app",
-	}
-
-	// Try to get app name from map, or use capitalized cask name + .app
-	appName, ok := caskToApp[caskName]
-	if !ok {
-		// Default: capitalize first letter and add .app
-		if len(caskName) > 0 {
-			appName = strings.ToUpper(caskName[0:1]) + caskName[1:] + ".app"
-		}
-	}
-
-	appPath := filepath.Join("/Applications", appName)
-	if _, err := os.Stat(appPath); err == nil {
-		return true, appPath
-	}
-
-	return false, ""
-}
-
-// IsFormulaLinked checks if a formula is properly linked in /opt/homebrew/bin
+// IsFormulaLinked checks if a formula is installed and linked into the brew prefix
 func IsFormulaLinked(ctx context.Context, verbose bool, name string) bool {
-	// Use brew info to check if the package has a linked_keg
-	res, err := utils.Run(ctx, verbose, 5*time.Second, GetBrewExecutable(), "info", "--json=v2", name)
-	if err != nil {
-		return false
-	}
-
-	// Check if linked_keg is not null in the JSON output
-	// linked_keg will be the version string if linked, or null if not
-	return strings.Contains(res.Stdout, `"linked_keg":`) && !strings.Contains(res.Stdout, `"linked_keg": null`)
+	return FormulaLinkState(ctx, verbose, name) == LinkLinked
 }
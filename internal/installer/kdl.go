@@ -0,0 +1,397 @@
+package installer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// checkKDL reports the first syntax error in a KDL (v1) document, the format
+// of Zellij's config. Only the syntax is checked; what the nodes mean is up to
+// Zellij.
+func checkKDL(data []byte) error {
+	p := &kdlParser{src: []rune(string(data)), line: 1}
+	return p.nodes(false)
+}
+
+const kdlEOF = -1
+
+var kdlNumber = regexp.MustCompile(`^[+-]?(0x[0-9a-fA-F][0-9a-fA-F_]*|0o[0-7][0-7_]*|0b[01][01_]*|[0-9][0-9_]*(\.[0-9][0-9_]*)?([eE][+-]?[0-9][0-9_]*)?)$`)
+
+type kdlParser struct {
+	src  []rune
+	pos  int
+	line int
+}
+
+func (p *kdlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *kdlParser) peekAt(n int) rune {
+	if p.pos+n >= len(p.src) {
+		return kdlEOF
+	}
+	return p.src[p.pos+n]
+}
+
+func (p *kdlParser) peek() rune { return p.peekAt(0) }
+
+func (p *kdlParser) next() rune {
+	r := p.peek()
+	if r != kdlEOF {
+		p.pos++
+	}
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *kdlParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:min(p.pos+len(s), len(p.src))]), s)
+}
+
+func isKDLNewline(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\u0085' || r == '\u000C' || r == '\u2028' || r == '\u2029'
+}
+
+func isKDLSpace(r rune) bool {
+	return r != kdlEOF && !isKDLNewline(r) && (unicode.IsSpace(r) || r == '\uFEFF')
+}
+
+func isKDLIdentRune(r rune) bool {
+	return r != kdlEOF && !isKDLNewline(r) && !isKDLSpace(r) && !strings.ContainsRune(`\/(){}<>;[]=,"`, r)
+}
+
+// nodes parses nodes up to the end of the input or, in a children block, up to
+// and including its closing brace.
+func (p *kdlParser) nodes(inBlock bool) error {
+	start := p.line
+	for {
+		if err := p.skipLineSpace(); err != nil {
+			return err
+		}
+		switch p.peek() {
+		case kdlEOF:
+			if inBlock {
+				return fmt.Errorf("line %d: block is never closed with }", start)
+			}
+			return nil
+		case '}':
+			if !inBlock {
+				return p.errorf("unexpected }")
+			}
+			p.next()
+			return nil
+		}
+		if err := p.node(); err != nil {
+			return err
+		}
+	}
+}
+
+// skipLineSpace skips whitespace, newlines, semicolons and comments between
+// nodes.
+func (p *kdlParser) skipLineSpace() error {
+	for {
+		switch r := p.peek(); {
+		case isKDLSpace(r), isKDLNewline(r), r == ';':
+			p.next()
+		case p.hasPrefix("//"):
+			p.skipLineComment()
+		case p.hasPrefix("/*"):
+			if err := p.skipBlockComment(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// skipSpace skips whitespace, block comments and line continuations inside a
+// node, and reports whether there were any.
+func (p *kdlParser) skipSpace() (bool, error) {
+	skipped := false
+	for {
+		switch r := p.peek(); {
+		case isKDLSpace(r):
+			p.next()
+		case p.hasPrefix("/*"):
+			if err := p.skipBlockComment(); err != nil {
+				return skipped, err
+			}
+		case r == '\\':
+			p.next()
+			for isKDLSpace(p.peek()) {
+				p.next()
+			}
+			if p.hasPrefix("//") {
+				p.skipLineComment()
+			}
+			if !isKDLNewline(p.peek()) && p.peek() != kdlEOF {
+				return skipped, p.errorf("\\ must end the line")
+			}
+			p.next()
+		default:
+			return skipped, nil
+		}
+		skipped = true
+	}
+}
+
+func (p *kdlParser) skipLineComment() {
+	for r := p.peek(); r != kdlEOF && !isKDLNewline(r); r = p.peek() {
+		p.next()
+	}
+}
+
+func (p *kdlParser) skipBlockComment() error {
+	start := p.line
+	depth := 0
+	for {
+		switch {
+		case p.peek() == kdlEOF:
+			return fmt.Errorf("line %d: comment is never closed with */", start)
+		case p.hasPrefix("/*"):
+			p.pos += 2
+			depth++
+		case p.hasPrefix("*/"):
+			p.pos += 2
+			if depth--; depth == 0 {
+				return nil
+			}
+		default:
+			p.next()
+		}
+	}
+}
+
+func (p *kdlParser) node() error {
+	if p.hasPrefix("/-") {
+		p.pos += 2
+		if _, err := p.skipSpace(); err != nil {
+			return err
+		}
+	}
+	if err := p.annotation(); err != nil {
+		return err
+	}
+	if err := p.name("node name"); err != nil {
+		return err
+	}
+	children := false
+	for {
+		spaced, err := p.skipSpace()
+		if err != nil {
+			return err
+		}
+		switch r := p.peek(); {
+		case r == kdlEOF, r == '}':
+			return nil
+		case isKDLNewline(r), r == ';':
+			p.next()
+			return nil
+		case p.hasPrefix("//"):
+			p.skipLineComment()
+			return nil
+		case children:
+			return p.errorf("unexpected %q after the children block", r)
+		case !spaced && r != '{':
+			return p.errorf("unexpected %q, want a space before it", r)
+		}
+		if p.hasPrefix("/-") {
+			p.pos += 2
+			if _, err := p.skipSpace(); err != nil {
+				return err
+			}
+		}
+		if p.peek() == '{' {
+			p.next()
+			if err := p.nodes(true); err != nil {
+				return err
+			}
+			children = true
+			continue
+		}
+		if err := p.entry(); err != nil {
+			return err
+		}
+	}
+}
+
+// entry parses an argument or a key=value property.
+func (p *kdlParser) entry() error {
+	if p.peek() == '(' {
+		if err := p.annotation(); err != nil {
+			return err
+		}
+		return p.value()
+	}
+	if p.startsString() {
+		if err := p.str(); err != nil {
+			return err
+		}
+	} else if p.startsNumber() {
+		return p.number()
+	} else {
+		ident, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if p.peek() != '=' {
+			switch ident {
+			case "true", "false", "null":
+				return nil
+			}
+			return p.errorf("bare word %q is not a value, quote it", ident)
+		}
+	}
+	if p.peek() == '=' {
+		p.next()
+		return p.value()
+	}
+	return nil
+}
+
+func (p *kdlParser) value() error {
+	if err := p.annotation(); err != nil {
+		return err
+	}
+	switch {
+	case p.startsString():
+		return p.str()
+	case p.startsNumber():
+		return p.number()
+	}
+	ident, err := p.ident()
+	if err != nil {
+		return err
+	}
+	switch ident {
+	case "true", "false", "null":
+		return nil
+	}
+	return p.errorf("bare word %q is not a value, quote it", ident)
+}
+
+// annotation parses an optional type annotation such as (u8).
+func (p *kdlParser) annotation() error {
+	if p.peek() != '(' {
+		return nil
+	}
+	p.next()
+	if err := p.name("type name"); err != nil {
+		return err
+	}
+	if p.next() != ')' {
+		return p.errorf("type annotation is not closed with )")
+	}
+	return nil
+}
+
+// name parses an identifier or a string.
+func (p *kdlParser) name(what string) error {
+	if p.startsString() {
+		return p.str()
+	}
+	if p.startsNumber() {
+		return p.errorf("%s cannot start with a digit", what)
+	}
+	if !isKDLIdentRune(p.peek()) {
+		if p.peek() == kdlEOF {
+			return p.errorf("missing %s", what)
+		}
+		return p.errorf("unexpected %q, want a %s", p.peek(), what)
+	}
+	_, err := p.ident()
+	return err
+}
+
+func (p *kdlParser) ident() (string, error) {
+	start := p.pos
+	for isKDLIdentRune(p.peek()) {
+		p.next()
+	}
+	if p.pos == start {
+		if p.peek() == kdlEOF {
+			return "", p.errorf("unexpected end of file")
+		}
+		return "", p.errorf("unexpected %q", p.peek())
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+func (p *kdlParser) startsString() bool {
+	r := p.peek()
+	return r == '"' || (r == 'r' && (p.peekAt(1) == '"' || p.peekAt(1) == '#'))
+}
+
+func (p *kdlParser) startsNumber() bool {
+	r := p.peek()
+	if r == '+' || r == '-' {
+		r = p.peekAt(1)
+	}
+	return r >= '0' && r <= '9'
+}
+
+func (p *kdlParser) number() error {
+	start := p.pos
+	for isKDLIdentRune(p.peek()) {
+		p.next()
+	}
+	if n := string(p.src[start:p.pos]); !kdlNumber.MatchString(n) {
+		return p.errorf("bad number %q", n)
+	}
+	return nil
+}
+
+// str parses a quoted string, with escapes, or a raw string such as r#"..."#.
+func (p *kdlParser) str() error {
+	start := p.line
+	if p.peek() == 'r' {
+		p.next()
+		hashes := 0
+		for p.peek() == '#' {
+			p.next()
+			hashes++
+		}
+		if p.next() != '"' {
+			return p.errorf("raw string must start with \"")
+		}
+		end := "\"" + strings.Repeat("#", hashes)
+		for !p.hasPrefix(end) {
+			if p.next() == kdlEOF {
+				return fmt.Errorf("line %d: string is never closed", start)
+			}
+		}
+		p.pos += len(end)
+		return nil
+	}
+	p.next()
+	for {
+		switch p.next() {
+		case kdlEOF:
+			return fmt.Errorf("line %d: string is never closed", start)
+		case '"':
+			return nil
+		case '\\':
+			switch e := p.next(); e {
+			case 'n', 'r', 't', '\\', '/', '"', 'b', 'f':
+			case 'u':
+				if p.next() != '{' {
+					return p.errorf(`\u must be followed by {hex}`)
+				}
+				for r := p.next(); r != '}'; r = p.next() {
+					if !unicode.Is(unicode.ASCII_Hex_Digit, r) {
+						return p.errorf(`bad \u escape`)
+					}
+				}
+			default:
+				return p.errorf("unknown escape \\%c", e)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package installer
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// missingKDLNodes returns the top-level nodes of team that user does not
+// define, so that a managed block in a KDL file only adds what the user's
+// config lacks instead of repeating sections Zellij would read twice. The
+// user's own sections win; comments above a node go with it.
+func missingKDLNodes(user, team []byte) []byte {
+	have := make(map[string]bool)
+	nodes, _ := kdlTopLevel(user)
+	for _, n := range nodes {
+		have[n.name] = true
+	}
+	nodes, rest := kdlTopLevel(team)
+	var b bytes.Buffer
+	for _, n := range nodes {
+		if !have[n.name] {
+			b.Write(n.text)
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	b.Write(rest)
+	return bytes.TrimLeft(b.Bytes(), "\n")
+}
+
+// kdlNode is a top-level node of a KDL document: its name, and its text from
+// the end of the previous node through its own end.
+type kdlNode struct {
+	name string
+	text []byte
+}
+
+// kdlTopLevel splits src into its top-level nodes and whatever follows the
+// last of them. It only tracks strings, comments and braces, so it finds the
+// nodes of any document Zellij accepts without checking the syntax; nodes
+// commented out with /- are kept with the text before the next node.
+func kdlTopLevel(src []byte) (nodes []kdlNode, rest []byte) {
+	from := 0
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';':
+			i++
+		case bytes.HasPrefix(src[i:], []byte("//")):
+			i = kdlLineEnd(src, i)
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			i = kdlCommentEnd(src, i)
+		default:
+			slashdash := bytes.HasPrefix(src[i:], []byte("/-"))
+			name := kdlNodeName(src, i)
+			i = kdlNodeEnd(src, i)
+			if !slashdash {
+				nodes = append(nodes, kdlNode{name: name, text: src[from:i]})
+				from = i
+			}
+		}
+	}
+	return nodes, src[from:]
+}
+
+// kdlNodeName returns the name of the node starting at i, past a type
+// annotation, unquoting a quoted name.
+func kdlNodeName(src []byte, i int) string {
+	if bytes.HasPrefix(src[i:], []byte("/-")) {
+		i += 2
+	}
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	if i < len(src) && src[i] == '(' {
+		if end := bytes.IndexByte(src[i:], ')'); end >= 0 {
+			i += end + 1
+		}
+	}
+	if i < len(src) && src[i] == '"' {
+		end := kdlStringEnd(src, i)
+		if name, err := strconv.Unquote(string(src[i:end])); err == nil {
+			return name
+		}
+		return string(src[i:end])
+	}
+	start := i
+	for i < len(src) && !bytes.ContainsRune([]byte(" \t\r\n;{}()=\"\\/"), rune(src[i])) {
+		i++
+	}
+	return string(src[start:i])
+}
+
+// kdlNodeEnd returns the offset just past the node starting at i: past the
+// newline or semicolon that ends it outside any children block.
+func kdlNodeEnd(src []byte, i int) int {
+	depth := 0
+	for i < len(src) {
+		switch c := src[i]; {
+		case c == '"':
+			i = kdlStringEnd(src, i)
+		case c == 'r' && kdlRawStringStart(src, i):
+			i = kdlRawStringEnd(src, i)
+		case bytes.HasPrefix(src[i:], []byte("//")):
+			i = kdlLineEnd(src, i)
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			i = kdlCommentEnd(src, i)
+		case c == '\\':
+			// A line continuation: the node goes on after the newline.
+			i = kdlLineEnd(src, i) + 1
+		case c == '{':
+			depth++
+			i++
+		case c == '}':
+			depth--
+			i++
+		case (c == '\n' || c == ';') && depth <= 0:
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(src)
+}
+
+// kdlLineEnd returns the offset of the newline ending the line at i.
+func kdlLineEnd(src []byte, i int) int {
+	if end := bytes.IndexByte(src[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(src)
+}
+
+// kdlCommentEnd returns the offset just past the (nested) /* comment at i.
+func kdlCommentEnd(src []byte, i int) int {
+	depth := 0
+	for i < len(src) {
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			depth++
+			i += 2
+		case bytes.HasPrefix(src[i:], []byte("*/")):
+			i += 2
+			if depth--; depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(src)
+}
+
+// kdlStringEnd returns the offset just past the quoted string at i.
+func kdlStringEnd(src []byte, i int) int {
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// kdlRawStringStart reports whether the r at i opens a raw string such as
+// r#"..."# rather than being part of an identifier.
+func kdlRawStringStart(src []byte, i int) bool {
+	if i > 0 && !bytes.ContainsRune([]byte(" \t\r\n;{(=)"), rune(src[i-1])) {
+		return false
+	}
+	j := i + 1
+	for j < len(src) && src[j] == '#' {
+		j++
+	}
+	return j < len(src) && src[j] == '"'
+}
+
+// kdlRawStringEnd returns the offset just past the raw string at i.
+func kdlRawStringEnd(src []byte, i int) int {
+	j := i + 1
+	for j < len(src) && src[j] == '#' {
+		j++
+	}
+	end := append([]byte{'"'}, src[i+1:j]...)
+	if k := bytes.Index(src[j+1:], end); k >= 0 {
+		return j + 1 + k + len(end)
+	}
+	return len(src)
+}
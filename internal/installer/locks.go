@@ -0,0 +1,126 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"macsetup/internal/constants"
+)
+
+// Resource names something that steps share. Locks on a resource have
+// reader/writer semantics: any number of readers, or a single writer.
+type Resource string
+
+const (
+	// ResBrew is the Homebrew installation. Queries (list, info, fetch) read
+	// it; anything that changes the prefix or taps writes it.
+	ResBrew    Resource = "brew"
+	ResZshrc   Resource = "~/.zshrc"
+	ResOhMyZsh Resource = "~/.oh-my-zsh"
+	// ResBackups is the backup index, which steps writing files in parallel
+	// all add to.
+	ResBackups Resource = "~/" + constants.BackupIndexPath
+)
+
+// Lock is a resource together with the access a step needs to it.
+type Lock struct {
+	Resource Resource
+	Write    bool
+}
+
+func ReadLock(r Resource) Lock  { return Lock{Resource: r} }
+func WriteLock(r Resource) Lock { return Lock{Resource: r, Write: true} }
+
+// String returns e.g. "brew-read" or "~/.zshrc-write".
+func (l Lock) String() string {
+	if l.Write {
+		return string(l.Resource) + "-write"
+	}
+	return string(l.Resource) + "-read"
+}
+
+// LockManager hands out named reader/writer locks.
+type LockManager struct {
+	mu    sync.Mutex
+	locks map[Resource]*sync.RWMutex
+}
+
+func NewLockManager() *LockManager {
+	return &LockManager{locks: make(map[Resource]*sync.RWMutex)}
+}
+
+// resources guards everything the installer shares between goroutines.
+var resources = NewLockManager()
+
+type heldLocksKey struct{}
+
+// Acquire takes locks and returns a context recording them along with a
+// function that releases them. The locks of one call are taken in resource
+// order, so two single calls can never wait on each other. A nested call,
+// made while the context holds locks, takes its own on top of those whatever
+// their order; that stays deadlock free as long as nested locks follow one
+// hierarchy: a step's own locks (the files it writes), then brew, then the
+// backup index, under which nothing else is taken. Resources the context
+// already holds are not locked again, which lets a step that holds
+// brew-write call functions that lock brew themselves; asking to upgrade a
+// held read lock to a write lock is a bug and panics.
+func (lm *LockManager) Acquire(ctx context.Context, locks ...Lock) (context.Context, func()) {
+	held, _ := ctx.Value(heldLocksKey{}).(map[Resource]bool)
+
+	wanted := make(map[Resource]bool, len(locks))
+	for _, l := range locks {
+		wanted[l.Resource] = wanted[l.Resource] || l.Write
+	}
+	names := make([]string, 0, len(wanted))
+	for r := range wanted {
+		names = append(names, string(r))
+	}
+	sort.Strings(names)
+
+	var release []func()
+	next := make(map[Resource]bool, len(held)+len(wanted))
+	for r, w := range held {
+		next[r] = w
+	}
+	for _, name := range names {
+		r := Resource(name)
+		write := wanted[r]
+		if w, ok := held[r]; ok {
+			if write && !w {
+				panic(fmt.Sprintf("installer: cannot upgrade %s to %s", ReadLock(r), WriteLock(r)))
+			}
+			continue
+		}
+		mu := lm.get(r)
+		if write {
+			mu.Lock()
+			release = append(release, mu.Unlock)
+		} else {
+			mu.RLock()
+			release = append(release, mu.RUnlock)
+		}
+		next[r] = write
+	}
+
+	if len(release) == 0 {
+		return ctx, func() {}
+	}
+	return context.WithValue(ctx, heldLocksKey{}, next), func() {
+		for i := len(release) - 1; i >= 0; i-- {
+			release[i]()
+		}
+	}
+}
+
+func (lm *LockManager) get(r Resource) *sync.RWMutex {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	mu, ok := lm.locks[r]
+	if !ok {
+		mu = &sync.RWMutex{}
+		lm.locks[r] = mu
+	}
+	return mu
+}
@@ -0,0 +1,150 @@
+package installer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockManagerReadersShare(t *testing.T) {
+	lm := NewLockManager()
+	_, r1 := lm.Acquire(context.Background(), ReadLock(ResBrew))
+	defer r1()
+
+	acquired := make(chan struct{})
+	go func() {
+		_, r2 := lm.Acquire(context.Background(), ReadLock(ResBrew))
+		r2()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second reader blocked")
+	}
+}
+
+func TestLockManagerWriterExcludes(t *testing.T) {
+	lm := NewLockManager()
+	_, release := lm.Acquire(context.Background(), WriteLock(ResZshrc))
+
+	acquired := make(chan struct{})
+	go func() {
+		_, r := lm.Acquire(context.Background(), ReadLock(ResZshrc))
+		r()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("reader got in while a writer held the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("reader never got the lock after release")
+	}
+}
+
+func TestLockManagerHeldLocksAreReentrant(t *testing.T) {
+	lm := NewLockManager()
+	ctx, release := lm.Acquire(context.Background(), WriteLock(ResBrew), WriteLock(ResZshrc))
+	defer release()
+
+	// Would deadlock if the held write lock were taken again.
+	_, inner := lm.Acquire(ctx, ReadLock(ResBrew), WriteLock(ResBrew))
+	inner()
+}
+
+func TestLockManagerNestedAcquire(t *testing.T) {
+	lm := NewLockManager()
+	// As the dotfiles step does: the file first, then brew and the backup
+	// index from the functions it calls, which sort before it.
+	ctx, release := lm.Acquire(context.Background(), WriteLock(ResZshrc))
+	_, inner := lm.Acquire(ctx, ReadLock(ResBrew), WriteLock(ResBackups))
+
+	brewWrite := make(chan struct{})
+	go func() {
+		_, r := lm.Acquire(context.Background(), WriteLock(ResBrew))
+		r()
+		close(brewWrite)
+	}()
+	select {
+	case <-brewWrite:
+		t.Fatal("brew-write got in while a nested brew-read was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	inner()
+	select {
+	case <-brewWrite:
+	case <-time.After(time.Second):
+		t.Fatal("brew-write never got the lock after the nested release")
+	}
+
+	// Releasing the nested locks leaves the outer ones held.
+	zshrc := make(chan struct{})
+	go func() {
+		_, r := lm.Acquire(context.Background(), ReadLock(ResZshrc))
+		r()
+		close(zshrc)
+	}()
+	select {
+	case <-zshrc:
+		t.Fatal("~/.zshrc was released with the nested locks")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	<-zshrc
+}
+
+func TestLockManagerUpgradePanics(t *testing.T) {
+	lm := NewLockManager()
+	ctx, release := lm.Acquire(context.Background(), ReadLock(ResBrew))
+	defer release()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic when upgrading brew-read to brew-write")
+		}
+	}()
+	lm.Acquire(ctx, WriteLock(ResBrew))
+}
+
+func TestRunStepsOrderAndLocks(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		order  []string
+		inside atomic.Int32
+	)
+	record := func(name string) func(context.Context) []InstallResult {
+		return func(context.Context) []InstallResult {
+			if inside.Add(1) > 1 {
+				t.Errorf("%s ran while another writer held ~/.zshrc", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+			inside.Add(-1)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return []InstallResult{{Message: name}}
+		}
+	}
+	steps := []step{
+		{name: "fzf", after: []string{"dotfiles"}, locks: []Lock{WriteLock(ResZshrc)}, run: record("fzf")},
+		{name: "dotfiles", after: []string{"ohmyzsh"}, locks: []Lock{WriteLock(ResZshrc)}, run: record("dotfiles")},
+		{name: "ohmyzsh", locks: []Lock{WriteLock(ResZshrc)}, run: record("ohmyzsh")},
+	}
+
+	results := runSteps(context.Background(), steps)
+	if want := []string{"ohmyzsh", "dotfiles", "fzf"}; len(order) != 3 || order[0] != want[0] || order[1] != want[1] || order[2] != want[2] {
+		t.Fatalf("ran in order %v, want %v", order, want)
+	}
+	// Results come back in declaration order, not completion order.
+	if results[0].Message != "fzf" || results[2].Message != "ohmyzsh" {
+		t.Fatalf("results out of step order: %+v", results)
+	}
+}
@@ -15,17 +15,38 @@ import (
 type Manager struct {
 	maxWorkers int
 	progress   chan ProgressUpdate
+	output     chan OutputEvent
 	verbose    bool
+	opts       RunOptions
+	sources    config.Sources
+	timeouts   config.Timeouts
+	logMu      sync.Mutex
+
+	attemptsMu   sync.Mutex
+	attempts     map[attemptKey]*utils.AttemptLog
+	attemptOrder []attemptKey
+
+	casks *caskInfos
 }
 
 func NewManager(maxWorkers int, opts RunOptions) *Manager {
 	if maxWorkers <= 0 {
 		maxWorkers = 5
 	}
+	timeouts := opts.Timeouts
+	if timeouts.IsZero() {
+		timeouts = config.DefaultTimeouts()
+	}
 	return &Manager{
 		maxWorkers: maxWorkers,
 		progress:   make(chan ProgressUpdate, 128),
+		output:     make(chan OutputEvent, 512),
 		verbose:    opts.Verbose,
+		opts:       opts,
+		sources:    opts.Sources.WithDefaults(),
+		timeouts:   timeouts,
+		attempts:   make(map[attemptKey]*utils.AttemptLog),
+		casks:      newCaskInfos(),
 	}
 }
 
@@ -33,16 +54,36 @@ func (m *Manager) Progress() <-chan ProgressUpdate {
 	return m.progress
 }
 
+// Output streams command output line by line while Run is in progress. Lines
+// are dropped when the reader falls behind; RunOptions.Log gets all of them.
+func (m *Manager) Output() <-chan OutputEvent {
+	return m.output
+}
+
 func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, error) {
 	defer close(m.progress)
+	defer close(m.output)
+
+	if m.opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, m.opts.Deadline, utils.ErrDeadline)
+		defer cancel()
+	}
 
 	pkgs := selectedPackages(selected)
 	results := make([]InstallResult, 0, len(pkgs)+10)
 
-	if !IsXcodeInstalled(ctx) {
+	if !utils.IsMacOS() {
+		task := config.Package{Name: "Xcode CLI Tools", Type: config.TypeSystem, Category: "core", Required: true, Default: true}
+		m.emit(task, StatusSkipped, "Not needed on Linux", "")
+		results = append(results, InstallResult{Package: task, Status: StatusSkipped, Message: "Not needed on Linux"})
+	} else if stopRequested(ctx) {
+		task := config.Package{Name: "Xcode CLI Tools", Type: config.TypeSystem, Category: "core", Required: true, Default: true}
+		results = append(results, m.cancelled(task))
+	} else if !IsXcodeInstalled(ctx) {
 		task := config.Package{Name: "Xcode CLI Tools", Type: config.TypeSystem, Category: "core", Required: true, Default: true}
 		m.emit(task, StatusRunning, "", "")
-		status, msg, errStr, dur := timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
+		status, msg, errStr, dur := timed(m.withOutput(ctx, task), m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
 			_ = TriggerXcodeInstall(ctx)
 			if err := WaitForXcode(ctx, 2*time.Second); err != nil {
 				return StatusFailed, "", err
@@ -60,11 +101,14 @@ func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, e
 		results = append(results, InstallResult{Package: task, Status: StatusSkipped, Message: "Already installed"})
 	}
 
-	if !IsBrewInstalled(ctx, m.verbose) {
+	if stopRequested(ctx) {
+		task := config.Package{Name: "Homebrew", Type: config.TypeSystem, Category: "core", Required: true, Default: true}
+		results = append(results, m.cancelled(task))
+	} else if !IsBrewInstalled(ctx, m.verbose) {
 		task := config.Package{Name: "Homebrew", Type: config.TypeSystem, Category: "core", Required: true, Default: true}
 		m.emit(task, StatusRunning, "", "")
-		status, msg, errStr, dur := timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-			if err := InstallBrew(ctx, m.verbose); err != nil {
+		status, msg, errStr, dur := timed(m.limit(m.withOutput(ctx, task), config.StepScript), m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
+			if err := InstallBrew(ctx, m.verbose, m.sources.HomebrewInstallScript); err != nil {
 				return StatusFailed, "", err
 			}
 			return StatusInstalled, "", nil
@@ -80,10 +124,14 @@ func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, e
 		results = append(results, InstallResult{Package: task, Status: StatusSkipped, Message: "Already installed"})
 	}
 
-	{
-		task := config.Package{Name: "Homebrew update", Type: config.TypeTask, Category: "core", Required: true, Default: true}
+	if task := (config.Package{Name: "Homebrew update", Type: config.TypeTask, Category: "core", Required: true, Default: true}); stopRequested(ctx) {
+		results = append(results, m.cancelled(task))
+	} else {
 		m.emit(task, StatusRunning, "", "")
-		status, msg, errStr, dur := timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
+		status, msg, errStr, dur := timed(m.limit(m.withOutput(ctx, task), config.StepBrewUpdate), m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
+			if m.opts.Bundle != nil {
+				return StatusSkipped, "Offline mode", nil
+			}
 			if err := BrewUpdate(ctx, m.verbose); err != nil {
 				return StatusSkipped, "Update failed (non-critical)", nil
 			}
@@ -102,8 +150,12 @@ func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, e
 	taps, formulas, casks := splitBrewPackages(pkgs)
 
 	for _, tap := range taps {
+		if stopRequested(ctx) {
+			results = append(results, m.cancelled(tap))
+			continue
+		}
 		m.emit(tap, StatusRunning, "", "")
-		status, msg, errStr, dur := timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
+		status, msg, errStr, dur := timed(m.limit(m.withOutput(ctx, tap), config.StepTap), m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
 			installed, err := IsTapInstalled(ctx, m.verbose, tap.Tap)
 			if err != nil {
 				return StatusFailed, "", err
@@ -111,7 +163,11 @@ func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, e
 			if installed {
 				return StatusSkipped, "Already tapped", nil
 			}
-			if err := AddTap(ctx, m.verbose, tap.Tap); err != nil {
+			remote := ""
+			if m.opts.Bundle != nil {
+				remote = m.opts.Bundle.TapRemote(tap.Tap)
+			}
+			if err := AddTap(ctx, m.verbose, tap.Tap, remote); err != nil {
 				return StatusFailed, "", err
 			}
 			return StatusInstalled, "", nil
@@ -123,42 +179,49 @@ func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, e
 		results = append(results, InstallResult{Package: tap, Status: status, Message: msg, Error: errStr, Duration: dur})
 	}
 
-	results = append(results, m.installFormulas(ctx, formulas)...)
-	for _, cask := range casks {
-		m.emit(cask, StatusRunning, "", "")
-		status, msg, errStr, dur := timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-			// First check if installed via Homebrew
-			installed, err := IsBrewPackageInstalled(ctx, m.verbose, cask)
-			if err != nil {
-				return StatusFailed, "", err
-			}
-			if installed {
-				return StatusSkipped, "Already installed", nil
-			}
-
-			// Check if app exists manually in /Applications
-			appExists, appPath := IsCaskAppInstalled(cask.Name)
-			if appExists {
-				return StatusSkipped, fmt.Sprintf("Already installed at %s", appPath), nil
-			}
-
-			if err := InstallCask(ctx, m.verbose, cask.Name); err != nil {
-				return StatusFailed, "", err
-			}
-			return StatusInstalled, "", nil
-		})
-		if errStr != "" {
-			errStr = classifyInstallError(cask, fmt.Errorf("%s", errStr))
-		}
-		m.emit(cask, status, msg, errStr)
-		results = append(results, InstallResult{Package: cask, Status: status, Message: msg, Error: errStr, Duration: dur})
+	// Everything from here on runs as steps, concurrently where their
+	// dependencies and resource locks allow.
+	var downloads map[string]time.Duration
+	steps := []step{
+		{
+			name: stepPrefetch,
+			run: func(ctx context.Context) []InstallResult {
+				var r InstallResult
+				downloads, r = m.prefetch(ctx, formulas, casks)
+				return []InstallResult{r}
+			},
+		},
+		{
+			name:  stepFormulas,
+			after: []string{stepPrefetch},
+			run: func(ctx context.Context) []InstallResult {
+				if m.opts.Batch {
+					return m.installFormulasBatch(ctx, formulas, downloads)
+				}
+				return m.installFormulas(ctx, formulas, downloads)
+			},
+		},
+		{
+			name:  stepCasks,
+			after: []string{stepPrefetch},
+			run: func(ctx context.Context) []InstallResult {
+				if m.opts.Batch {
+					return m.installCasksBatch(ctx, casks, downloads)
+				}
+				var results []InstallResult
+				for _, cask := range casks {
+					results = append(results, m.installCask(ctx, cask, downloads))
+				}
+				return results
+			},
+		},
 	}
+	steps = append(steps, m.postInstallSteps(selected)...)
+	results = append(results, runSteps(ctx, steps)...)
 
-	postResults := m.postInstall(ctx)
-	results = append(results, postResults...)
-
-	{
-		task := config.Package{Name: "Post-install verification", Type: config.TypeTask, Category: "core", Required: true, Default: true}
+	if task := (config.Package{Name: "Post-install verification", Type: config.TypeTask, Category: "core", Required: true, Default: true}); stopRequested(ctx) {
+		results = append(results, m.cancelled(task))
+	} else {
 		m.emit(task, StatusRunning, "", "")
 		start := time.Now()
 		ver := VerifyCriticalTools(ctx)
@@ -182,149 +245,177 @@ func (m *Manager) Run(ctx context.Context, selected map[string]bool) (Summary, e
 		}
 	}
 
-	return Summary{Results: results}, nil
+	m.addAttempts(results)
+	summary := Summary{Results: results}
+	if m.opts.Checkpoint != "" {
+		if err := WriteCheckpoint(m.opts.Checkpoint, summary); err != nil {
+			task := config.Package{Name: checkpointTask, Type: config.TypeTask, Category: "core"}
+			summary.Results = append(summary.Results, InstallResult{Package: task, Status: StatusFailed, Error: err.Error()})
+		}
+	}
+	return summary, nil
 }
 
-func (m *Manager) postInstall(ctx context.Context) []InstallResult {
-	var results []InstallResult
-
-	dirsTask := config.Package{Name: "Create config directories", Type: config.TypeTask, Category: "core"}
-	m.emit(dirsTask, StatusRunning, "", "")
-	st, msg, errStr, dur := timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		if err := CreateConfigDirectories(); err != nil {
-			return StatusFailed, "", err
+// handleExistingApp applies the adoption policy to a cask whose app is already
+// present but not managed by Homebrew.
+func (m *Manager) handleExistingApp(ctx context.Context, cask config.Package, app CaskApp) (InstallStatus, string, error) {
+	policy := m.opts.AdoptPolicyFor(cask)
+	if policy == config.AdoptSkip {
+		if app.Version != "" {
+			return StatusSkipped, fmt.Sprintf("Already installed at %s (version %s)", app.Path, app.Version), nil
 		}
-		return StatusInstalled, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(dirsTask, fmt.Errorf("%s", errStr))
+		return StatusSkipped, fmt.Sprintf("Already installed at %s", app.Path), nil
 	}
-	m.emit(dirsTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: dirsTask, Status: st, Message: msg, Error: errStr, Duration: dur})
 
-	ohTask := config.Package{Name: "Oh My Zsh", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(ohTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		installed, err := IsOhMyZshInstalled()
-		if err != nil {
-			return StatusFailed, "", err
-		}
-		if installed {
-			return StatusSkipped, "Already installed", nil
-		}
-		if err := InstallOhMyZsh(ctx); err != nil {
-			return StatusFailed, "", err
-		}
-		return StatusInstalled, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(ohTask, fmt.Errorf("%s", errStr))
+	note := ""
+	if info, err := m.casks.get(ctx, m.verbose, cask.Name); err == nil && caskVersionDiffers(app.Version, info.Version) {
+		note = fmt.Sprintf(" (bundle %s differs from cask %s)", app.Version, info.Version)
 	}
-	m.emit(ohTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: ohTask, Status: st, Message: msg, Error: errStr, Duration: dur})
 
-	pluginsTask := config.Package{Name: "Zsh plugins", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(pluginsTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		outcome, err := InstallZshPlugins(ctx)
-		if err != nil {
-			return StatusFailed, "", err
+	switch policy {
+	case config.AdoptAdopt:
+		if err := AdoptCask(ctx, m.verbose, cask.Name); err != nil {
+			return StatusFailed, "", fmt.Errorf("failed to adopt %s%s: %w", app.Path, note, err)
 		}
-		if outcome == StatusSkipped {
-			return StatusSkipped, "Already installed", nil
+		return StatusAdopted, fmt.Sprintf("Adopted %s%s", app.Path, note), nil
+	case config.AdoptReplace:
+		if err := ReplaceCask(ctx, m.verbose, cask.Name); err != nil {
+			return StatusFailed, "", fmt.Errorf("failed to replace %s%s: %w", app.Path, note, err)
 		}
-		return StatusInstalled, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(pluginsTask, fmt.Errorf("%s", errStr))
+		return StatusInstalled, fmt.Sprintf("Replaced %s%s", app.Path, note), nil
+	default:
+		return StatusFailed, "", fmt.Errorf("unknown adoption policy %q", policy)
 	}
-	m.emit(pluginsTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: pluginsTask, Status: st, Message: msg, Error: errStr, Duration: dur})
+}
 
+// postInstallSteps returns the setup tasks that follow the Homebrew packages.
+// Each declares the steps it must follow and the resources it touches, so
+// independent ones (git clones, mise, Oh My Zsh) run side by side.
+func (m *Manager) postInstallSteps(selected map[string]bool) []step {
+	dirsTask := config.Package{Name: "Create config directories", Type: config.TypeTask, Category: "core"}
+	ohTask := config.Package{Name: "Oh My Zsh", Type: config.TypeTask, Category: "shell_cli"}
+	pluginsTask := config.Package{Name: "Zsh plugins", Type: config.TypeTask, Category: "shell_cli"}
 	nvimTask := config.Package{Name: "Neovim config (kickstart)", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(nvimTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		outcome, err := CloneNeovimConfig(ctx)
-		if err != nil {
-			return StatusFailed, "", err
-		}
-		return outcome, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(nvimTask, fmt.Errorf("%s", errStr))
-	}
-	m.emit(nvimTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: nvimTask, Status: st, Message: msg, Error: errStr, Duration: dur})
-
 	tpmTask := config.Package{Name: "tmux plugin manager (TPM)", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(tpmTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		outcome, err := CloneTPM(ctx)
-		if err != nil {
-			return StatusFailed, "", err
-		}
-		return outcome, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(tpmTask, fmt.Errorf("%s", errStr))
-	}
-	m.emit(tpmTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: tpmTask, Status: st, Message: msg, Error: errStr, Duration: dur})
-
 	miseTask := config.Package{Name: "Mise runtimes", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(miseTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		if _, err := utils.Run(ctx, m.verbose, 5*time.Second, "mise", "--version"); err != nil {
-			return StatusSkipped, "mise not installed yet", nil
-		}
-		if err := SetupMise(ctx); err != nil {
-			return StatusFailed, "", err
-		}
-		return StatusInstalled, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(miseTask, fmt.Errorf("%s", errStr))
-	}
-	m.emit(miseTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: miseTask, Status: st, Message: msg, Error: errStr, Duration: dur})
-
 	dotTask := config.Package{Name: "Dotfiles", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(dotTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		backupCount, err := WriteDotfiles()
-		if err != nil {
-			return StatusFailed, "", err
-		}
-		if backupCount > 0 {
-			return StatusInstalled, fmt.Sprintf("Backed up %d file(s)", backupCount), nil
-		}
-		return StatusInstalled, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(dotTask, fmt.Errorf("%s", errStr))
-	}
-	m.emit(dotTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: dotTask, Status: st, Message: msg, Error: errStr, Duration: dur})
-
 	fzfTask := config.Package{Name: "Configure fzf", Type: config.TypeTask, Category: "shell_cli"}
-	m.emit(fzfTask, StatusRunning, "", "")
-	st, msg, errStr, dur = timed(ctx, m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
-		outcome, err := ConfigureFzf(ctx)
-		if err != nil {
-			return StatusFailed, "", err
-		}
-		return outcome, "", nil
-	})
-	if errStr != "" {
-		errStr = classifyInstallError(fzfTask, fmt.Errorf("%s", errStr))
-	}
-	m.emit(fzfTask, st, msg, errStr)
-	results = append(results, InstallResult{Package: fzfTask, Status: st, Message: msg, Error: errStr, Duration: dur})
 
-	return results
+	return []step{
+		{
+			name: dirsTask.Name,
+			run: m.task(dirsTask, config.StepTask, func(ctx context.Context) (InstallStatus, string, error) {
+				if err := CreateConfigDirectories(); err != nil {
+					return StatusFailed, "", err
+				}
+				return StatusInstalled, "", nil
+			}),
+		},
+		{
+			// The Oh My Zsh installer replaces ~/.zshrc.
+			name:  ohTask.Name,
+			locks: []Lock{WriteLock(ResOhMyZsh), WriteLock(ResZshrc)},
+			run: m.task(ohTask, config.StepScript, func(ctx context.Context) (InstallStatus, string, error) {
+				installed, err := IsOhMyZshInstalled()
+				if err != nil {
+					return StatusFailed, "", err
+				}
+				if installed {
+					return StatusSkipped, "Already installed", nil
+				}
+				if err := InstallOhMyZsh(ctx, m.sources.OhMyZshInstallScript); err != nil {
+					return StatusFailed, "", err
+				}
+				return StatusInstalled, "", nil
+			}),
+		},
+		{
+			name:  pluginsTask.Name,
+			after: []string{ohTask.Name},
+			locks: []Lock{WriteLock(ResOhMyZsh)},
+			run: m.task(pluginsTask, config.StepGit, func(ctx context.Context) (InstallStatus, string, error) {
+				outcome, err := InstallZshPlugins(ctx, m.sources.ZshPlugins)
+				if err != nil {
+					return StatusFailed, "", err
+				}
+				if outcome == StatusSkipped {
+					return StatusSkipped, "Already installed", nil
+				}
+				return StatusInstalled, "", nil
+			}),
+		},
+		{
+			name:  nvimTask.Name,
+			after: []string{dirsTask.Name},
+			run: m.task(nvimTask, config.StepGit, func(ctx context.Context) (InstallStatus, string, error) {
+				outcome, err := CloneNeovimConfig(ctx, m.sources.KickstartNvim)
+				if err != nil {
+					return StatusFailed, "", err
+				}
+				return outcome, "", nil
+			}),
+		},
+		{
+			name:  tpmTask.Name,
+			after: []string{dirsTask.Name},
+			run: m.task(tpmTask, config.StepGit, func(ctx context.Context) (InstallStatus, string, error) {
+				outcome, err := CloneTPM(ctx, m.sources.TPM)
+				if err != nil {
+					return StatusFailed, "", err
+				}
+				return outcome, "", nil
+			}),
+		},
+		{
+			name:  miseTask.Name,
+			after: []string{stepFormulas},
+			run: m.task(miseTask, config.StepMise, func(ctx context.Context) (InstallStatus, string, error) {
+				if m.opts.Bundle != nil {
+					return StatusSkipped, "Offline mode (runtimes need the network)", nil
+				}
+				if _, err := utils.Run(ctx, m.verbose, 5*time.Second, "mise", "--version"); err != nil {
+					return StatusSkipped, "mise not installed yet", nil
+				}
+				if err := SetupMise(ctx); err != nil {
+					return StatusFailed, "", err
+				}
+				return StatusInstalled, "", nil
+			}),
+		},
+		{
+			// Written after Oh My Zsh so its installer cannot replace our .zshrc.
+			name:  dotTask.Name,
+			after: []string{dirsTask.Name, ohTask.Name},
+			locks: []Lock{WriteLock(ResZshrc)},
+			run: m.task(dotTask, config.StepTask, func(ctx context.Context) (InstallStatus, string, error) {
+				data := NewTemplateData(ctx, m.opts.Dotfiles, selected)
+				report, err := WriteDotfiles(ctx, m.opts.Dotfiles, data)
+				if err != nil {
+					return StatusFailed, "", err
+				}
+				if report.Written() == 0 {
+					return StatusSkipped, report.Message(), nil
+				}
+				return StatusInstalled, report.Message(), nil
+			}),
+		},
+		{
+			// fzf's install script appends to ~/.zshrc, so it goes after Dotfiles.
+			name:  fzfTask.Name,
+			after: []string{stepFormulas, dotTask.Name},
+			locks: []Lock{ReadLock(ResBrew), WriteLock(ResZshrc)},
+			run: m.task(fzfTask, config.StepScript, func(ctx context.Context) (InstallStatus, string, error) {
+				outcome, err := ConfigureFzf(ctx)
+				if err != nil {
+					return StatusFailed, "", err
+				}
+				return outcome, "", nil
+			}),
+		},
+	}
 }
 
-func (m *Manager) installFormulas(ctx context.Context, formulas []config.Package) []InstallResult {
+func (m *Manager) installFormulas(ctx context.Context, formulas []config.Package, downloads map[string]time.Duration) []InstallResult {
 	jobs := make(chan config.Package)
 	out := make(chan InstallResult, len(formulas))
 	var wg sync.WaitGroup
@@ -338,53 +429,16 @@ func (m *Manager) installFormulas(ctx context.Context, formulas []config.Package
 		go func() {
 			defer wg.Done()
 			for pkg := range jobs {
-				m.emit(pkg, StatusRunning, "", "")
-
-				start := time.Now()
-				status := StatusInstalled
-				msg := ""
-				errStr := ""
-
-				installed, err := IsBrewPackageInstalled(ctx, m.verbose, pkg)
-				if err != nil {
-					status = StatusFailed
-					errStr = err.Error()
-				} else if installed {
-					// Package is installed, but check if it's linked
-					if !IsFormulaLinked(ctx, m.verbose, pkg.Name) {
-						// Try to link it
-						if err := LinkFormula(ctx, m.verbose, pkg.Name); err != nil {
-							status = StatusFailed
-							errStr = fmt.Sprintf("installed but not linked: %v", err)
-						} else {
-							status = StatusSkipped
-							msg = "Already installed (relinked)"
-						}
-					} else {
-						status = StatusSkipped
-						msg = "Already installed"
-					}
-				} else {
-					if err := InstallFormula(ctx, m.verbose, pkg.Name); err != nil {
-						status = StatusFailed
-						errStr = classifyInstallError(pkg, err)
-					}
-				}
-
-				m.emit(pkg, status, msg, errStr)
-				out <- InstallResult{Package: pkg, Status: status, Message: msg, Error: errStr, Duration: time.Since(start)}
+				out <- m.installFormula(ctx, pkg, downloads)
 			}
 		}()
 	}
 
+	// Every formula is handed to a worker, even after a stop, so each one
+	// gets a result; installFormula reports the unstarted ones as cancelled.
 	go func() {
 		for _, f := range formulas {
-			select {
-			case <-ctx.Done():
-				close(jobs)
-				return
-			case jobs <- f:
-			}
+			jobs <- f
 		}
 		close(jobs)
 		wg.Wait()
@@ -401,6 +455,210 @@ func (m *Manager) installFormulas(ctx context.Context, formulas []config.Package
 	return results
 }
 
+// installFormula installs one formula, relinking it if it is already installed
+// but not linked.
+func (m *Manager) installFormula(ctx context.Context, pkg config.Package, downloads map[string]time.Duration) InstallResult {
+	if stopRequested(ctx) {
+		return m.cancelled(pkg)
+	}
+	ctx = m.limit(m.withOutput(ctx, pkg), config.StepFormula)
+	m.emit(pkg, StatusRunning, "", "")
+
+	start := time.Now()
+	var waited time.Duration
+	status := StatusInstalled
+	msg := ""
+	errStr := ""
+
+	installed, err := IsBrewPackageInstalled(ctx, m.verbose, pkg)
+	if err != nil {
+		status = StatusFailed
+		errStr = err.Error()
+	} else if installed {
+		status, msg, errStr = m.existingFormula(ctx, pkg)
+	} else {
+		ctx, release, wait := lockBrew(ctx)
+		waited = wait
+		installStart := time.Now()
+		install := func(ctx context.Context) error { return InstallFormula(ctx, m.verbose, pkg.Name) }
+		if err := install(ctx); err != nil {
+			status, msg, err = m.remediate(ctx, pkg, err, install)
+			if err != nil {
+				errStr = classifyInstallError(pkg, err)
+			}
+		} else if dl, ok := downloads[pkg.Name]; ok {
+			msg = installMessage(dl, time.Since(installStart))
+		}
+		release()
+	}
+
+	m.emit(pkg, status, msg, errStr)
+	return InstallResult{Package: pkg, Status: status, Message: msg, Error: errStr, Duration: time.Since(start) - waited, DownloadDuration: downloads[pkg.Name]}
+}
+
+// lockBrew takes the brew write lock for an install and returns how long it
+// waited for it: time spent queued behind other installs is not install time.
+func lockBrew(ctx context.Context) (context.Context, func(), time.Duration) {
+	start := time.Now()
+	ctx, release := resources.Acquire(ctx, WriteLock(ResBrew))
+	return ctx, release, time.Since(start)
+}
+
+// existingFormula reports on a formula that is already installed, linking it
+// first if needed.
+func (m *Manager) existingFormula(ctx context.Context, pkg config.Package) (InstallStatus, string, string) {
+	switch FormulaLinkState(ctx, m.verbose, pkg.Name) {
+	case LinkUnlinked:
+		// Try to link it
+		if err := LinkFormula(m.command(ctx, pkg, "link"), m.verbose, pkg.Name); err != nil {
+			return StatusFailed, "", fmt.Sprintf("installed but not linked: %v", err)
+		}
+		return StatusSkipped, "Already installed (relinked)", ""
+	case LinkKegOnly:
+		return StatusSkipped, "Already installed (keg-only)", ""
+	default:
+		return StatusSkipped, "Already installed", ""
+	}
+}
+
+// installCask installs one cask, applying the adoption policy when its app is
+// already present outside Homebrew.
+func (m *Manager) installCask(ctx context.Context, cask config.Package, downloads map[string]time.Duration) InstallResult {
+	if stopRequested(ctx) {
+		return m.cancelled(cask)
+	}
+	if !utils.IsMacOS() {
+		m.emit(cask, StatusSkipped, "Casks are not supported on Linux", "")
+		return InstallResult{Package: cask, Status: StatusSkipped, Message: "Casks are not supported on Linux"}
+	}
+	m.emit(cask, StatusRunning, "", "")
+	var waited time.Duration
+	status, msg, errStr, dur := timed(m.limit(m.withOutput(ctx, cask), config.StepCask), m.verbose, func(ctx context.Context) (InstallStatus, string, error) {
+		// First check if installed via Homebrew
+		installed, err := IsBrewPackageInstalled(ctx, m.verbose, cask)
+		if err != nil {
+			return StatusFailed, "", err
+		}
+		if installed {
+			return StatusSkipped, "Already installed", nil
+		}
+
+		// Check if app exists manually in /Applications or ~/Applications
+		if app, exists := m.casks.findApp(ctx, m.verbose, cask); exists {
+			return m.handleExistingApp(ctx, cask, app)
+		}
+
+		ctx, release, wait := lockBrew(ctx)
+		defer release()
+		waited = wait
+		installStart := time.Now()
+		install := func(ctx context.Context) error { return InstallCask(ctx, m.verbose, cask.Name) }
+		if err := install(ctx); err != nil {
+			return m.remediate(ctx, cask, err, install)
+		}
+		if dl, ok := downloads[cask.Name]; ok {
+			return StatusInstalled, installMessage(dl, time.Since(installStart)), nil
+		}
+		return StatusInstalled, "", nil
+	})
+	if errStr != "" {
+		errStr = classifyInstallError(cask, fmt.Errorf("%s", errStr))
+	}
+	m.emit(cask, status, msg, errStr)
+	return InstallResult{Package: cask, Status: status, Message: msg, Error: errStr, Duration: dur - waited, DownloadDuration: downloads[cask.Name]}
+}
+
+// limit applies the timeout policy for kind to commands run with the
+// returned context.
+func (m *Manager) limit(ctx context.Context, kind config.StepKind) context.Context {
+	return utils.WithLimits(ctx, m.limits(kind))
+}
+
+func (m *Manager) limits(kind config.StepKind) utils.Limits {
+	p := m.timeouts.For(kind)
+	return utils.Limits{Timeout: time.Duration(p.Timeout), Stall: time.Duration(p.Stall), Retries: p.Retries}
+}
+
+// withOutput tags the output and retries of commands run with the returned
+// context as belonging to pkg. Retries count toward the step's own command
+// (see defaultCommand) unless the context is narrowed with command.
+func (m *Manager) withOutput(ctx context.Context, pkg config.Package) context.Context {
+	ctx = m.command(ctx, pkg, defaultCommand(pkg))
+	return utils.WithLineHandler(ctx, func(stream, line string) {
+		m.emitOutput(pkg, stream, line)
+	})
+}
+
+// command counts the retries of commands run with the returned context
+// against command of pkg, e.g. "fetch" or "link", so that they are not mixed
+// up with the retries of the step's other commands.
+func (m *Manager) command(ctx context.Context, pkg config.Package, command string) context.Context {
+	return utils.WithAttemptLog(ctx, m.attemptLog(attemptKey{pkg: string(pkg.Type) + "/" + pkg.Name, command: command}))
+}
+
+// attemptKey names one command of one step.
+type attemptKey struct {
+	pkg     string
+	command string
+}
+
+func defaultCommand(pkg config.Package) string {
+	switch pkg.Type {
+	case config.TypeFormula, config.TypeCask:
+		return "install"
+	case config.TypeTap:
+		return "tap"
+	default:
+		return "run"
+	}
+}
+
+func (m *Manager) attemptLog(key attemptKey) *utils.AttemptLog {
+	m.attemptsMu.Lock()
+	defer m.attemptsMu.Unlock()
+	log, ok := m.attempts[key]
+	if !ok {
+		log = &utils.AttemptLog{}
+		m.attempts[key] = log
+		m.attemptOrder = append(m.attemptOrder, key)
+	}
+	return log
+}
+
+// addAttempts records on each result which of its commands failed and how
+// often they were tried.
+func (m *Manager) addAttempts(results []InstallResult) {
+	m.attemptsMu.Lock()
+	defer m.attemptsMu.Unlock()
+	for i := range results {
+		pkg := string(results[i].Package.Type) + "/" + results[i].Package.Name
+		for _, key := range m.attemptOrder {
+			log := m.attempts[key]
+			failures := log.Failures()
+			if key.pkg != pkg || len(failures) == 0 {
+				continue
+			}
+			ca := CommandAttempts{Command: key.command, Attempts: 1 + log.Retries()}
+			for _, a := range failures {
+				ca.Errors = append(ca.Errors, fmt.Sprintf("[%s] %s", a.Class, a.Err))
+			}
+			results[i].Retries = append(results[i].Retries, ca)
+		}
+	}
+}
+
+func (m *Manager) emitOutput(pkg config.Package, stream, line string) {
+	if m.opts.Log != nil {
+		m.logMu.Lock()
+		_, _ = fmt.Fprintf(m.opts.Log, "[%s] %-25s | %s\n", time.Now().Format("15:04:05"), pkg.Name, line)
+		m.logMu.Unlock()
+	}
+	select {
+	case m.output <- OutputEvent{Package: pkg, Stream: stream, Line: line}:
+	default:
+	}
+}
+
 func (m *Manager) emit(pkg config.Package, status InstallStatus, message, errStr string) {
 	select {
 	case m.progress <- ProgressUpdate{Package: pkg, Status: status, Message: message, Error: errStr}:
@@ -0,0 +1,22 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"macsetup/internal/config"
+)
+
+// ApplyNetwork exports the network settings into the process environment so
+// every command macsetup spawns (curl, git, brew and the install scripts)
+// inherits the same proxies, mirrors and Homebrew domains.
+func ApplyNetwork(n config.Network) error {
+	for _, kv := range n.Env() {
+		key, value, _ := strings.Cut(kv, "=")
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
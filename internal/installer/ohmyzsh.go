@@ -5,20 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
-	"macsetup/internal/constants"
+	"macsetup/internal/config"
 	"macsetup/internal/utils"
 )
 
-var zshPlugins = map[string]string{
-	"zsh-autosuggestions":     "https://github.com/zsh-users/zsh-autosuggestions.git",
-	"zsh-autocomplete":        "https://github.com/marlonrichert/zsh-autocomplete.git",
-	"zsh-syntax-highlighting": "https://github.com/zsh-users/zsh-syntax-highlighting.git",
-	"zsh-completions":         "https://github.com/zsh-users/zsh-completions.git",
-}
-
 func IsOhMyZshInstalled() (bool, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -28,7 +19,7 @@ func IsOhMyZshInstalled() (bool, error) {
 	return err == nil, nil
 }
 
-func InstallOhMyZsh(ctx context.Context) error {
+func InstallOhMyZsh(ctx context.Context, installScript config.Asset) error {
 	installed, err := IsOhMyZshInstalled()
 	if err != nil {
 		return err
@@ -46,16 +37,7 @@ func InstallOhMyZsh(ctx context.Context) error {
 		_ = os.Remove(scriptPath)
 	}()
 
-	if err := utils.Retry(ctx, false, utils.RetryOptions{Attempts: 3, BaseDelay: 500 * time.Millisecond}, func(ctx context.Context) error {
-		res, err := utils.Run(ctx, false, 0, "curl", "-fsSL", "-o", scriptPath, constants.OhMyZshInstallURL)
-		if err != nil {
-			if strings.TrimSpace(res.Stderr) != "" {
-				return fmt.Errorf("%w: %s", err, strings.TrimSpace(res.Stderr))
-			}
-			return err
-		}
-		return nil
-	}); err != nil {
+	if err := downloadAsset(ctx, false, installScript, scriptPath); err != nil {
 		return err
 	}
 
@@ -63,7 +45,7 @@ func InstallOhMyZsh(ctx context.Context) error {
 	return err
 }
 
-func InstallZshPlugins(ctx context.Context) (InstallStatus, error) {
+func InstallZshPlugins(ctx context.Context, plugins map[string]config.Asset) (InstallStatus, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return StatusFailed, err
@@ -72,7 +54,7 @@ func InstallZshPlugins(ctx context.Context) (InstallStatus, error) {
 	pluginsDir := filepath.Join(home, ".oh-my-zsh", "custom", "plugins")
 
 	allPresent := true
-	for name := range zshPlugins {
+	for name := range plugins {
 		dest := filepath.Join(pluginsDir, name)
 		if !utils.Exists(dest) {
 			allPresent = false
@@ -87,12 +69,12 @@ func InstallZshPlugins(ctx context.Context) (InstallStatus, error) {
 		return StatusFailed, err
 	}
 
-	for name, url := range zshPlugins {
+	for name, asset := range plugins {
 		dest := filepath.Join(pluginsDir, name)
 		if utils.Exists(dest) {
 			continue
 		}
-		if err := GitClone(ctx, url, dest); err != nil {
+		if err := GitClone(ctx, asset, dest); err != nil {
 			return StatusFailed, fmt.Errorf("failed to clone %s: %w", name, err)
 		}
 	}
@@ -21,6 +21,49 @@ type PlanOptions struct {
 
 type RunOptions struct {
 	Verbose bool
+	// Adopt is the run-wide policy for casks whose app already exists outside Homebrew.
+	Adopt config.AdoptPolicy
+	// AdoptOverrides sets the policy for individual casks by name.
+	AdoptOverrides map[string]config.AdoptPolicy
+	// Sources are the remote install scripts and repositories, with mirrors
+	// already applied. Empty fields fall back to the built-in defaults.
+	Sources config.Sources
+	// Batch installs all missing formulas, and all missing casks, with one
+	// brew install each, falling back to single installs for failures.
+	Batch bool
+	// Timeouts bounds the commands each kind of step runs. Zero means
+	// config.DefaultTimeouts.
+	Timeouts config.Timeouts
+	// Dotfiles is how the Dotfiles step writes configs and where it reads
+	// them from. An empty mode means config.DotfilesMerge, an empty source
+	// the configs built into macsetup.
+	Dotfiles config.Dotfiles
+	// Checkpoint, when set, is where Run saves the outcome of every step when
+	// it finishes or is interrupted.
+	Checkpoint string
+	// Deadline, when set, bounds the whole run. Steps still running when it
+	// passes are stopped and fail with a timeout.
+	Deadline time.Duration
+	// Log, when set, receives every line of command output, tagged with the
+	// step it belongs to.
+	Log io.Writer
+	// Bundle, when set, runs offline from a bundle made by `macsetup bundle create`.
+	Bundle *Bundle
+}
+
+// AdoptPolicyFor resolves the adoption policy for pkg: per-package overrides
+// first, then the catalog entry, then the run-wide policy.
+func (o RunOptions) AdoptPolicyFor(pkg config.Package) config.AdoptPolicy {
+	if p, ok := o.AdoptOverrides[pkg.Name]; ok {
+		return p
+	}
+	if pkg.Adopt != "" {
+		return pkg.Adopt
+	}
+	if o.Adopt != "" {
+		return o.Adopt
+	}
+	return config.AdoptSkip
 }
 
 func RunInstallPlan(ctx context.Context, selected map[string]bool, maxWorkers int, out io.Writer, opts RunOptions) (Summary, error) {
@@ -42,10 +85,10 @@ func RunInstallPlan(ctx context.Context, selected map[string]bool, maxWorkers in
 		done <- summary
 	}()
 
+	// No early return on ctx.Done: an interrupted Run still returns a summary
+	// with the steps it did not get to marked cancelled.
 	for updates != nil || done != nil || errCh != nil {
 		select {
-		case <-ctx.Done():
-			return Summary{}, ctx.Err()
 		case err := <-errCh:
 			errCh = nil
 			return Summary{}, err
@@ -77,6 +120,10 @@ func formatProgress(upd ProgressUpdate, verbose bool) string {
 		status = "skipped"
 	case StatusFailed:
 		status = "failed"
+	case StatusAdopted:
+		status = "adopted"
+	case StatusCancelled:
+		status = "cancelled"
 	default:
 		status = string(upd.Status)
 	}
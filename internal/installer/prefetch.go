@@ -0,0 +1,126 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// prefetch downloads every formula and cask that is not installed yet with up
+// to maxWorkers concurrent `brew fetch` runs, so the serialized installs that
+// follow only pour from the cache. It returns the download time per package
+// and a result row for the phase. A failed fetch is not fatal: the install
+// downloads whatever is still missing.
+func (m *Manager) prefetch(ctx context.Context, formulas, casks []config.Package) (map[string]time.Duration, InstallResult) {
+	task := config.Package{Name: "Prefetch downloads", Type: config.TypeTask, Category: "core", Required: true, Default: true}
+	downloads := make(map[string]time.Duration)
+
+	if stopRequested(ctx) {
+		return downloads, m.cancelled(task)
+	}
+	if m.opts.Bundle != nil {
+		m.emit(task, StatusSkipped, "Offline mode", "")
+		return downloads, InstallResult{Package: task, Status: StatusSkipped, Message: "Offline mode"}
+	}
+
+	pkgs := append([]config.Package{}, formulas...)
+	if utils.IsMacOS() {
+		pkgs = append(pkgs, casks...)
+	}
+
+	m.emit(task, StatusRunning, "", "")
+	start := time.Now()
+
+	jobs := make(chan config.Package)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		fetched int
+		failed  int
+	)
+	for i := 0; i < m.maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pkg := range jobs {
+				if stopRequested(ctx) {
+					continue
+				}
+				if installed, err := IsBrewPackageInstalled(ctx, m.verbose, pkg); err != nil || installed {
+					continue
+				}
+				if m.skipsExistingApp(ctx, pkg) {
+					continue
+				}
+				m.emit(pkg, StatusRunning, "Downloading", "")
+				fetchStart := time.Now()
+				err := FetchPackage(m.command(m.limit(m.withOutput(ctx, pkg), stepKind(pkg)), pkg, "fetch"), m.verbose, pkg)
+				dur := time.Since(fetchStart)
+
+				mu.Lock()
+				if err != nil {
+					failed++
+				} else {
+					fetched++
+					downloads[pkg.Name] = dur
+				}
+				mu.Unlock()
+
+				if err != nil {
+					m.emit(pkg, StatusPending, "Download failed, retrying during install", "")
+				} else {
+					m.emit(pkg, StatusPending, fmt.Sprintf("Downloaded in %s", dur.Round(100*time.Millisecond)), "")
+				}
+			}
+		}()
+	}
+
+	for _, pkg := range pkgs {
+		if stopRequested(ctx) {
+			break
+		}
+		jobs <- pkg
+	}
+	close(jobs)
+	wg.Wait()
+
+	dur := time.Since(start)
+	status := StatusInstalled
+	msg := fmt.Sprintf("Downloaded %d packages with %d workers", fetched, m.maxWorkers)
+	if fetched == 0 && failed == 0 {
+		status = StatusSkipped
+		msg = "Nothing to download"
+	}
+	if failed > 0 {
+		msg += fmt.Sprintf(" (%d failed, retrying during install)", failed)
+	}
+	m.emit(task, status, msg, "")
+	return downloads, InstallResult{Package: task, Status: status, Message: msg, Duration: dur}
+}
+
+// skipsExistingApp reports whether pkg is a cask whose app is already present
+// and that the adoption policy leaves alone, so there is nothing to download.
+func (m *Manager) skipsExistingApp(ctx context.Context, pkg config.Package) bool {
+	if pkg.Type != config.TypeCask || m.opts.AdoptPolicyFor(pkg) != config.AdoptSkip {
+		return false
+	}
+	_, exists := m.casks.findApp(ctx, m.verbose, pkg)
+	return exists
+}
+
+// stepKind returns the timeout policy that applies to a Homebrew package.
+func stepKind(pkg config.Package) config.StepKind {
+	if pkg.Type == config.TypeCask {
+		return config.StepCask
+	}
+	return config.StepFormula
+}
+
+// installMessage describes an install that was preceded by a prefetch.
+func installMessage(download, install time.Duration) string {
+	return fmt.Sprintf("download %s, install %s", download.Round(100*time.Millisecond), install.Round(100*time.Millisecond))
+}
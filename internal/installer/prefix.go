@@ -0,0 +1,70 @@
+package installer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"macsetup/internal/utils"
+)
+
+// Standard Homebrew prefixes per platform.
+const (
+	PrefixAppleSilicon = "/opt/homebrew"
+	PrefixIntel        = "/usr/local"
+	PrefixLinux        = "/home/linuxbrew/.linuxbrew"
+)
+
+// BrewPrefix resolves the Homebrew prefix in this order: `brew --prefix` when
+// brew is on PATH, $HOMEBREW_PREFIX, the first standard prefix that contains
+// bin/brew, and finally the platform default.
+func BrewPrefix(ctx context.Context) string {
+	fromBrew := ""
+	if brew, err := exec.LookPath("brew"); err == nil {
+		if res, err := utils.Run(ctx, false, 5*time.Second, brew, "--prefix"); err == nil {
+			fromBrew = strings.TrimSpace(res.Stdout)
+		}
+	}
+	return resolveBrewPrefix(fromBrew, os.Getenv("HOMEBREW_PREFIX"), runtime.GOOS, runtime.GOARCH, brewExists)
+}
+
+// installedBrewPrefix is BrewPrefix without running brew, for hot paths.
+func installedBrewPrefix() string {
+	return resolveBrewPrefix("", os.Getenv("HOMEBREW_PREFIX"), runtime.GOOS, runtime.GOARCH, brewExists)
+}
+
+func resolveBrewPrefix(fromBrew, fromEnv, goos, goarch string, exists func(prefix string) bool) string {
+	if fromBrew != "" {
+		return fromBrew
+	}
+	if fromEnv != "" {
+		return fromEnv
+	}
+	candidates := candidatePrefixes(goos, goarch)
+	for _, prefix := range candidates {
+		if exists(prefix) {
+			return prefix
+		}
+	}
+	return candidates[0]
+}
+
+// candidatePrefixes lists the standard prefixes for a platform, default first.
+func candidatePrefixes(goos, goarch string) []string {
+	switch {
+	case goos == "linux":
+		return []string{PrefixLinux, PrefixIntel}
+	case goarch == "arm64":
+		return []string{PrefixAppleSilicon, PrefixIntel}
+	default:
+		return []string{PrefixIntel, PrefixAppleSilicon}
+	}
+}
+
+func brewExists(prefix string) bool {
+	return utils.Exists(filepath.Join(prefix, "bin", "brew"))
+}
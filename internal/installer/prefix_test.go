@@ -0,0 +1,36 @@
+package installer
+
+import "testing"
+
+func TestResolveBrewPrefix(t *testing.T) {
+	none := func(string) bool { return false }
+	only := func(want string) func(string) bool {
+		return func(prefix string) bool { return prefix == want }
+	}
+
+	cases := []struct {
+		name     string
+		fromBrew string
+		fromEnv  string
+		goos     string
+		goarch   string
+		exists   func(string) bool
+		want     string
+	}{
+		{name: "brew --prefix wins", fromBrew: "/custom/brew", fromEnv: "/env/brew", goos: "darwin", goarch: "arm64", exists: none, want: "/custom/brew"},
+		{name: "env next", fromEnv: "/env/brew", goos: "darwin", goarch: "arm64", exists: none, want: "/env/brew"},
+		{name: "apple silicon default", goos: "darwin", goarch: "arm64", exists: none, want: PrefixAppleSilicon},
+		{name: "intel default", goos: "darwin", goarch: "amd64", exists: none, want: PrefixIntel},
+		{name: "linux default", goos: "linux", goarch: "amd64", exists: none, want: PrefixLinux},
+		{name: "rosetta brew on arm64", goos: "darwin", goarch: "arm64", exists: only(PrefixIntel), want: PrefixIntel},
+		{name: "linux user prefix in /usr/local", goos: "linux", goarch: "arm64", exists: only(PrefixIntel), want: PrefixIntel},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := resolveBrewPrefix(tc.fromBrew, tc.fromEnv, tc.goos, tc.goarch, tc.exists)
+			if got != tc.want {
+				t.Fatalf("got %q want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// fixFunc applies a remediation to a package whose install failed with err
+// and returns the outcome of the step afterwards. install runs the failed
+// install again.
+type fixFunc func(ctx context.Context, m *Manager, pkg config.Package, err error, install func(context.Context) error) (InstallStatus, string, error)
+
+// fixes holds the code behind each utils.FixAction.
+var fixes = map[utils.FixAction]fixFunc{
+	utils.FixAdoptApp:      fixExistingApp,
+	utils.FixClearDownload: fixClearDownload,
+	utils.FixLink:          fixLink,
+}
+
+// remediate is consulted before a failed install is given up on. When the
+// error rules name a fix for err it is applied; otherwise, or when the fix
+// fails too, the step fails with the original error.
+func (m *Manager) remediate(ctx context.Context, pkg config.Package, err error, install func(context.Context) error) (InstallStatus, string, error) {
+	ie := utils.ClassifyError(pkg.Name, err, err.Error())
+	fix, ok := fixes[ie.Fix]
+	if !ok {
+		return StatusFailed, "", err
+	}
+	utils.EmitLine(ctx, fmt.Sprintf("%s; trying automatic fix %q", ie.Message, ie.Fix))
+	status, msg, fixErr := fix(m.command(ctx, pkg, "fix "+string(ie.Fix)), m, pkg, err, install)
+	if fixErr != nil {
+		return StatusFailed, fmt.Sprintf("Automatic fix %q failed: %v", ie.Fix, fixErr), err
+	}
+	return status, msg, nil
+}
+
+var existingAppRe = regexp.MustCompile(`already an? (?:App|Binary|Font) at '([^']+)'`)
+
+// fixExistingApp treats a cask that brew refused to install over an existing
+// app the same way as one found before installing: by the adoption policy.
+func fixExistingApp(ctx context.Context, m *Manager, pkg config.Package, err error, _ func(context.Context) error) (InstallStatus, string, error) {
+	match := existingAppRe.FindStringSubmatch(err.Error())
+	if match == nil {
+		return StatusFailed, "", errors.New("could not find the app's path in brew's output")
+	}
+	return m.handleExistingApp(ctx, pkg, CaskApp{Path: match[1]})
+}
+
+func fixClearDownload(ctx context.Context, m *Manager, pkg config.Package, _ error, install func(context.Context) error) (InstallStatus, string, error) {
+	path, err := CachedDownload(ctx, m.verbose, pkg)
+	if err != nil {
+		return StatusFailed, "", err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return StatusFailed, "", err
+	}
+	if err := install(ctx); err != nil {
+		return StatusFailed, "", err
+	}
+	return StatusInstalled, "Installed after clearing a corrupt download", nil
+}
+
+func fixLink(ctx context.Context, m *Manager, pkg config.Package, _ error, _ func(context.Context) error) (InstallStatus, string, error) {
+	if pkg.Type != config.TypeFormula {
+		return StatusFailed, "", fmt.Errorf("only formulas can be linked")
+	}
+	if err := LinkFormula(ctx, m.verbose, pkg.Name); err != nil {
+		return StatusFailed, "", err
+	}
+	return StatusInstalled, "Installed (linked over conflicting files)", nil
+}
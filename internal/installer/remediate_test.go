@@ -0,0 +1,88 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+func TestRemediate(t *testing.T) {
+	cask := config.Package{Name: "google-chrome", Type: config.TypeCask}
+	cases := []struct {
+		name       string
+		err        error
+		wantStatus InstallStatus
+		wantMsg    string
+		wantErr    bool
+	}{
+		{
+			name:       "existing app is skipped by policy",
+			err:        errors.New("exit status 1: Error: It seems there is already an App at '/Applications/Google Chrome.app'."),
+			wantStatus: StatusSkipped,
+			wantMsg:    "Already installed at /Applications/Google Chrome.app",
+		},
+		{
+			name:       "no fix for the error",
+			err:        errors.New("exit status 1: Error: No space left on device"),
+			wantStatus: StatusFailed,
+			wantErr:    true,
+		},
+		{
+			name:       "link fix refuses casks",
+			err:        errors.New("exit status 1: Error: Could not symlink bin/npm"),
+			wantStatus: StatusFailed,
+			wantMsg:    `Automatic fix "link" failed: only formulas can be linked`,
+			wantErr:    true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewManager(1, RunOptions{Adopt: config.AdoptSkip})
+			install := func(context.Context) error {
+				t.Fatalf("install must not be re-run")
+				return nil
+			}
+			status, msg, err := m.remediate(context.Background(), cask, tc.err, install)
+			if status != tc.wantStatus || msg != tc.wantMsg {
+				t.Fatalf("got %q %q, want %q %q", status, msg, tc.wantStatus, tc.wantMsg)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error: got %v", err)
+			}
+			if err != nil && err != tc.err {
+				t.Fatalf("error: got %v, want the original error", err)
+			}
+		})
+	}
+}
+
+func TestAttemptsKeyedByCommand(t *testing.T) {
+	m := NewManager(1, RunOptions{})
+	fd := config.Package{Name: "fd", Type: config.TypeFormula}
+	task := config.Package{Name: "fd", Type: config.TypeTask}
+	fail := func(ctx context.Context) error { return errors.New("curl: (56) Connection reset by peer") }
+	opts := utils.RetryOptions{Attempts: 2, BaseDelay: time.Millisecond, Classify: utils.RetryTransient}
+
+	_ = utils.Retry(m.command(m.withOutput(context.Background(), fd), fd, "fetch"), false, opts, fail)
+	_ = utils.Retry(m.withOutput(context.Background(), fd), false, opts, fail)
+	_ = utils.Retry(m.command(context.Background(), fd, "link"), false, utils.RetryOptions{Attempts: 1}, fail)
+
+	results := []InstallResult{{Package: fd}, {Package: task}}
+	m.addAttempts(results)
+	var got []string
+	for _, ca := range results[0].Retries {
+		got = append(got, fmt.Sprintf("%s:%d:%d", ca.Command, ca.Attempts, len(ca.Errors)))
+	}
+	if want := []string{"install:2:2", "fetch:2:2", "link:1:1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	if len(results[1].Retries) != 0 {
+		t.Fatalf("a task with the same name shares the formula's attempts: %+v", results[1].Retries)
+	}
+}
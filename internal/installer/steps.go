@@ -0,0 +1,78 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"macsetup/internal/config"
+)
+
+// Names of the Homebrew package steps other steps can wait for.
+const (
+	stepPrefetch = "Prefetch downloads"
+	stepFormulas = "Homebrew formulas"
+	stepCasks    = "Homebrew casks"
+)
+
+// step is one unit of the install plan. It starts once every step named in
+// after has finished and holds its locks while it runs.
+type step struct {
+	name  string
+	after []string
+	locks []Lock
+	run   func(ctx context.Context) []InstallResult
+}
+
+// runSteps runs steps as concurrently as their dependencies and locks allow
+// and returns their results in step order. Dependencies only order steps; a
+// step still runs when one it follows has failed. After a stop (see WithStop)
+// step bodies report themselves cancelled instead of starting.
+func runSteps(ctx context.Context, steps []step) []InstallResult {
+	done := make(map[string]chan struct{}, len(steps))
+	for _, s := range steps {
+		done[s.name] = make(chan struct{})
+	}
+
+	out := make([][]InstallResult, len(steps))
+	var wg sync.WaitGroup
+	for i, s := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[s.name])
+			for _, dep := range s.after {
+				if ch, ok := done[dep]; ok {
+					<-ch
+				}
+			}
+			ctx, release := resources.Acquire(ctx, s.locks...)
+			defer release()
+			out[i] = s.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var results []InstallResult
+	for _, r := range out {
+		results = append(results, r...)
+	}
+	return results
+}
+
+// task adapts a single-package function into a step body with the usual
+// progress updates, timeout policy and error classification.
+func (m *Manager) task(pkg config.Package, kind config.StepKind, fn func(context.Context) (InstallStatus, string, error)) func(context.Context) []InstallResult {
+	return func(ctx context.Context) []InstallResult {
+		if stopRequested(ctx) {
+			return []InstallResult{m.cancelled(pkg)}
+		}
+		m.emit(pkg, StatusRunning, "", "")
+		st, msg, errStr, dur := timed(m.limit(m.withOutput(ctx, pkg), kind), m.verbose, fn)
+		if errStr != "" {
+			errStr = classifyInstallError(pkg, fmt.Errorf("%s", errStr))
+		}
+		m.emit(pkg, st, msg, errStr)
+		return []InstallResult{{Package: pkg, Status: st, Message: msg, Error: errStr, Duration: dur}}
+	}
+}
@@ -0,0 +1,151 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+)
+
+// DefaultTheme is the terminal theme when the config names none.
+const DefaultTheme = "Atom One Dark"
+
+// TemplateData is what every dotfile template is rendered with.
+type TemplateData struct {
+	Timestamp  string
+	BrewPrefix string
+	User       config.DotfilesUser
+	// Packages are the names of the packages selected for this run or
+	// already installed, sorted; templates usually test them with the
+	// installed function.
+	Packages []string
+	// Terminal is the terminal app the configs are written for (a cask name
+	// such as "ghostty"), or "" for none.
+	Terminal string
+	Theme    string
+	// Vars are the team variables from the config, for custom sources.
+	Vars map[string]string
+}
+
+// terminalPreference decides which terminal the configs are written for when
+// several are selected or installed and the config names none. Terminals not
+// listed come after these, by name.
+var terminalPreference = []string{"ghostty", "iterm2"}
+
+// NewTemplateData gathers the template context for a run installing
+// selected. Packages already on the machine count as well, so the configs do
+// not drop a tool just because it was not picked again. Values set in cfg
+// win; the rest are detected (user from git, terminal from the packages, see
+// terminalPreference) or defaulted.
+func NewTemplateData(ctx context.Context, cfg config.Dotfiles, selected map[string]bool) TemplateData {
+	installed, _ := ScanInstalledPackages(ctx, config.AllPackages())
+	data := TemplateData{
+		Timestamp:  time.Now().Format(time.RFC3339),
+		BrewPrefix: BrewPrefix(ctx),
+		User:       cfg.User,
+		Terminal:   cfg.Terminal,
+		Theme:      cfg.Theme,
+		Vars:       cfg.Vars,
+		Packages:   templatePackages(selected, installed),
+	}
+	if data.Terminal == "" {
+		data.Terminal = preferredTerminal(data.Packages)
+	}
+	if data.User.Name == "" {
+		data.User.Name = gitConfig(ctx, "user.name")
+	}
+	if data.User.Email == "" {
+		data.User.Email = gitConfig(ctx, "user.email")
+	}
+	if data.Theme == "" {
+		data.Theme = DefaultTheme
+	}
+	if data.Vars == nil {
+		data.Vars = map[string]string{}
+	}
+	return data
+}
+
+// templatePackages returns the sorted names of the catalog packages that are
+// selected (required ones included) or installed.
+func templatePackages(selected, installed map[string]bool) []string {
+	var names []string
+	for _, pkg := range config.AllPackages() {
+		if pkg.Required || selected[pkg.Name] || installed[pkg.Name] {
+			names = append(names, pkg.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// preferredTerminal returns the terminal among packages that comes first in
+// terminalPreference, or "" when there is none.
+func preferredTerminal(packages []string) string {
+	rank := func(name string) int {
+		if i := slices.Index(terminalPreference, name); i >= 0 {
+			return i
+		}
+		return len(terminalPreference)
+	}
+	best := ""
+	for _, pkg := range config.AllPackages() {
+		if pkg.Category != "terminals" || !slices.Contains(packages, pkg.Name) {
+			continue
+		}
+		if best == "" || rank(pkg.Name) < rank(best) || rank(pkg.Name) == rank(best) && pkg.Name < best {
+			best = pkg.Name
+		}
+	}
+	return best
+}
+
+func gitConfig(ctx context.Context, key string) string {
+	res, err := utils.Run(ctx, false, 5*time.Second, "git", "config", "--global", key)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(res.Stdout)
+}
+
+// templateFuncs are the helpers available to dotfile templates:
+//
+//	{{if installed "zellij"}}...{{end}}
+//	{{default "SF Mono" .Vars.font}}
+//	{{join .Packages ", "}}
+func (d TemplateData) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"installed": func(name string) bool {
+			i := sort.SearchStrings(d.Packages, name)
+			return i < len(d.Packages) && d.Packages[i] == name
+		},
+		// value is untyped so that a missing map key, which the template
+		// passes as nil, falls back to def too.
+		"default": func(def string, value any) string {
+			if s, ok := value.(string); ok && s != "" {
+				return s
+			}
+			return def
+		},
+		"join": func(elems []string, sep string) string { return strings.Join(elems, sep) },
+	}
+}
+
+// render executes the template text named name with d.
+func (d TemplateData) render(name string, text []byte) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(d.templateFuncs()).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,140 @@
+package installer
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"macsetup/configs"
+	"macsetup/internal/config"
+)
+
+// sampleData is NewTemplateData without the lookups that depend on the
+// machine running the test.
+func sampleData(cfg config.Dotfiles, selected map[string]bool) TemplateData {
+	data := TemplateData{Timestamp: "2025-01-01T00:00:00Z", BrewPrefix: "/opt/homebrew", User: cfg.User,
+		Terminal: cfg.Terminal, Theme: cfg.Theme, Vars: cfg.Vars, Packages: templatePackages(selected, nil)}
+	return data
+}
+
+func TestRenderEveryTemplate(t *testing.T) {
+	src, err := openDotfiles(context.Background(), config.Dotfiles{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := make(map[string]bool)
+	for _, pkg := range config.AllPackages() {
+		all[pkg.Name] = true
+	}
+	contexts := map[string]TemplateData{
+		"empty":    {},
+		"defaults": sampleData(config.Dotfiles{Theme: DefaultTheme}, DefaultSelection()),
+		"everything": sampleData(config.Dotfiles{Terminal: "ghostty", Theme: "Dracula",
+			User: config.DotfilesUser{Name: "Ada", Email: "ada@example.com"}, Vars: map[string]string{"font": "Iosevka"}}, all),
+	}
+	for name, data := range contexts {
+		for _, f := range src.files {
+			out, err := renderDotfile(configs.FS, f, data)
+			if err != nil {
+				t.Errorf("%s with %s context: %v", f.src, name, err)
+			}
+			if strings.Contains(string(out), "<no value>") {
+				t.Errorf("%s with %s context renders a missing value:\n%s", f.src, name, out)
+			}
+			if err := validateDotfile(context.Background(), f.format, out); err != nil {
+				t.Errorf("%s with %s context is not valid %s: %v", f.src, name, f.format, err)
+			}
+		}
+	}
+}
+
+func TestTemplatesFollowSelection(t *testing.T) {
+	zshrc := dotfile{src: "zshrc.tmpl", template: true}
+	tmux := dotfile{src: "tmux.conf", template: true}
+
+	without := sampleData(config.Dotfiles{}, map[string]bool{})
+	without.Packages = nil // not even the required packages
+	out, err := renderDotfile(configs.FS, zshrc, without)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, absent := range []string{"  autojump", "starship init", "mise activate", `alias vim="nvim"`, "~/.fzf.zsh"} {
+		if strings.Contains(string(out), absent) {
+			t.Errorf("%q in .zshrc without the package selected", absent)
+		}
+	}
+
+	with := sampleData(config.Dotfiles{Terminal: "ghostty"}, DefaultSelection())
+	out, err = renderDotfile(configs.FS, zshrc, with)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, present := range []string{"  autojump", "starship init", "mise activate", `alias vim="nvim"`, `alias zj="zellij"`, "/opt/homebrew/bin"} {
+		if !strings.Contains(string(out), present) {
+			t.Errorf("%q missing from .zshrc", present)
+		}
+	}
+	out, err = renderDotfile(configs.FS, tmux, with)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "xterm-ghostty:RGB") {
+		t.Error("tmux.conf has no ghostty override with ghostty as the terminal")
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	data := TemplateData{Packages: []string{"fzf", "zellij"}, Vars: map[string]string{"font": "Iosevka"}}
+	cases := []struct{ text, want string }{
+		{`{{if installed "zellij"}}yes{{end}}`, "yes"},
+		{`{{if installed "tmux"}}yes{{end}}`, ""},
+		{`{{default "SF Mono" .Vars.font}}`, "Iosevka"},
+		{`{{default "SF Mono" .Vars.size}}`, "SF Mono"},
+		{`{{join .Packages ","}}`, "fzf,zellij"},
+	}
+	for _, tc := range cases {
+		got, err := data.render("t", []byte(tc.text))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.text, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got %q want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestTemplatePackagesIncludeInstalled(t *testing.T) {
+	selected := map[string]bool{"iterm2": true}
+	installed := map[string]bool{"ghostty": true, "fzf": true, "formula:fzf": true}
+	got := templatePackages(selected, installed)
+	for _, name := range []string{"iterm2", "ghostty", "fzf"} {
+		if !slices.Contains(got, name) {
+			t.Errorf("%s missing from %v", name, got)
+		}
+	}
+	if slices.Contains(got, "formula:fzf") {
+		t.Errorf("scan keys leaked into %v", got)
+	}
+	if !sort.StringsAreSorted(got) {
+		t.Errorf("not sorted: %v", got)
+	}
+}
+
+func TestPreferredTerminal(t *testing.T) {
+	cases := []struct {
+		packages []string
+		want     string
+	}{
+		{packages: []string{"git", "iterm2"}, want: "iterm2"},
+		{packages: []string{"ghostty", "iterm2"}, want: "ghostty"},
+		{packages: []string{"git"}, want: ""},
+	}
+	for _, tc := range cases {
+		if got := preferredTerminal(tc.packages); got != tc.want {
+			t.Errorf("preferredTerminal(%v) = %q, want %q", tc.packages, got, tc.want)
+		}
+	}
+}
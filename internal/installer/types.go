@@ -14,6 +14,11 @@ const (
 	StatusInstalled InstallStatus = "installed"
 	StatusSkipped   InstallStatus = "skipped"
 	StatusFailed    InstallStatus = "failed"
+	// StatusAdopted marks an existing app that was handed over to Homebrew.
+	StatusAdopted InstallStatus = "adopted"
+	// StatusCancelled marks a step that never started because the run was
+	// interrupted.
+	StatusCancelled InstallStatus = "cancelled"
 )
 
 type InstallResult struct {
@@ -22,6 +27,21 @@ type InstallResult struct {
 	Message  string
 	Error    string
 	Duration time.Duration
+	// DownloadDuration is the time spent prefetching the package before
+	// Duration started.
+	DownloadDuration time.Duration
+	// Retries lists the commands of the step that failed at least once, in
+	// the order they first ran.
+	Retries []CommandAttempts
+}
+
+// CommandAttempts is how often one command of a step ran: once plus the
+// retries after transient failures. Errors holds the error of every failed
+// attempt, classified, oldest first.
+type CommandAttempts struct {
+	Command  string // "install", "fetch", "link", "fix <name>", ...
+	Attempts int
+	Errors   []string
 }
 
 type ProgressUpdate struct {
@@ -31,6 +51,13 @@ type ProgressUpdate struct {
 	Error   string
 }
 
+// OutputEvent is one line of output from a command run for Package.
+type OutputEvent struct {
+	Package config.Package
+	Stream  string
+	Line    string
+}
+
 type Summary struct {
 	Results []InstallResult
 }
@@ -44,3 +71,26 @@ func (s Summary) FailedCount() int {
 	}
 	return n
 }
+
+func (s Summary) CancelledCount() int {
+	n := 0
+	for _, r := range s.Results {
+		if r.Status == StatusCancelled {
+			n++
+		}
+	}
+	return n
+}
+
+// BrewTimes sums the prefetch and install time of formulas and casks. Downloads
+// run in parallel, so the download total can exceed the wall-clock time.
+func (s Summary) BrewTimes() (download, install time.Duration) {
+	for _, r := range s.Results {
+		if r.Package.Type != config.TypeFormula && r.Package.Type != config.TypeCask {
+			continue
+		}
+		download += r.DownloadDuration
+		install += r.Duration
+	}
+	return download, install
+}
@@ -0,0 +1,117 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"macsetup/internal/config"
+	"macsetup/internal/utils"
+
+	"github.com/BurntSushi/toml"
+)
+
+// validateDotfile checks a config against its format before it is written,
+// so that a typo in the team source, or in the user's part of a merged file,
+// is caught before it replaces a working file.
+func validateDotfile(ctx context.Context, format config.DotfileFormat, content []byte) error {
+	switch format {
+	case config.FormatTOML:
+		var v map[string]any
+		_, err := toml.Decode(string(content), &v)
+		return err
+	case config.FormatKDL:
+		// The syntax is always checked; where zellij is installed it checks
+		// what the nodes mean as well.
+		if err := checkKDL(content); err != nil {
+			return err
+		}
+		return checkWithTool(ctx, content, "zellij", false, func(file string) []string {
+			return []string{"--config", file, "setup", "--check"}
+		})
+	case config.FormatZsh:
+		return checkWithTool(ctx, content, "zsh", true, func(file string) []string {
+			return []string{"-n", file}
+		})
+	case config.FormatTmux:
+		if !tmuxCanParse(ctx) {
+			utils.EmitLine(ctx, fmt.Sprintf("tmux older than %d.%d cannot check a config without running it; not checking tmux.conf", tmuxParseMajor, tmuxParseMinor))
+			return nil
+		}
+		// A private server, so the user's sessions are never touched. Errors
+		// in the -f file are not reported by start-server, and sourcing it
+		// for real would run its run-shell lines, so source-file -n parses
+		// it instead.
+		return checkWithTool(ctx, content, "tmux", true, func(file string) []string {
+			return []string{"-S", filepath.Join(filepath.Dir(file), "tmux.sock"), "-f", "/dev/null",
+				"start-server", ";", "source-file", "-n", file, ";", "kill-server"}
+		})
+	}
+	return nil
+}
+
+// source-file -n, which parses a tmux config without running it, came with
+// tmux 3.2.
+const tmuxParseMajor, tmuxParseMinor = 3, 2
+
+var tmuxVersionRe = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// tmuxCanParse reports whether the installed tmux has source-file -n. A tmux
+// that is not installed counts as able, since checkWithTool skips it anyway;
+// a development build without a version number is taken to be recent.
+func tmuxCanParse(ctx context.Context) bool {
+	res, err := utils.Run(ctx, false, 5*time.Second, "tmux", "-V")
+	if err != nil {
+		return true
+	}
+	return tmuxVersionAtLeast(res.Stdout, tmuxParseMajor, tmuxParseMinor)
+}
+
+// tmuxVersionAtLeast reports whether the output of tmux -V, such as
+// "tmux 3.3a" or "tmux next-3.4", names major.minor or later.
+func tmuxVersionAtLeast(version string, major, minor int) bool {
+	m := tmuxVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return true
+	}
+	gotMajor, _ := strconv.Atoi(m[1])
+	gotMinor, _ := strconv.Atoi(m[2])
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
+
+// checkWithTool writes content to a temporary file and runs tool with args
+// on it. The check fails if tool exits non-zero or, when quiet, prints
+// anything; tools that report on success too are run with quiet unset. It is
+// skipped when tool is not installed.
+func checkWithTool(ctx context.Context, content []byte, tool string, quiet bool, args func(file string) []string) error {
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "macsetup-check-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config")
+	if err := os.WriteFile(file, content, 0o600); err != nil {
+		return err
+	}
+
+	res, err := utils.Run(ctx, false, 30*time.Second, tool, args(file)...)
+	out := strings.TrimSpace(strings.ReplaceAll(res.Stderr+res.Stdout, file+":", "line "))
+	switch {
+	case err != nil && out != "":
+		return fmt.Errorf("%s: %s", tool, out)
+	case err != nil:
+		return fmt.Errorf("%s: %w", tool, err)
+	case quiet && out != "":
+		return fmt.Errorf("%s: %s", tool, out)
+	}
+	return nil
+}
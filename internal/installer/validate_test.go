@@ -0,0 +1,90 @@
+package installer
+
+import (
+	"context"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"macsetup/configs"
+	"macsetup/internal/config"
+)
+
+func TestValidateDotfile(t *testing.T) {
+	cases := []struct {
+		name    string
+		format  config.DotfileFormat
+		content string
+		want    string // error substring, "" for valid
+		tool    string // needed on PATH
+	}{
+		{name: "toml", format: config.FormatTOML, content: "[general]\nimport = [\"a.toml\"]\n"},
+		{name: "toml missing quote", format: config.FormatTOML, content: "[font]\nfamily = \"Iosevka\n", want: "line 2"},
+		{name: "toml duplicate key", format: config.FormatTOML, content: "a = 1\na = 2\n", want: "already been defined"},
+		{name: "kdl", format: config.FormatKDL, content: "keybinds clear-defaults=true {\n  normal {\n    bind \"Ctrl a\" { SwitchToMode \"tmux\"; }\n  }\n}\n" +
+			"/* a /* nested */ comment */ theme r#\"dark \"one\"\"# // trailing\n/-ignored 1 2\nsize 0x1F -1.5e3 null \\\n  (u8)2\n"},
+		{name: "kdl unclosed block", format: config.FormatKDL, content: "keybinds {\n  normal {\n  }\n", want: "line 1: block is never closed"},
+		{name: "kdl stray brace", format: config.FormatKDL, content: "a 1\n}\n", want: "line 2: unexpected }"},
+		{name: "kdl bare word", format: config.FormatKDL, content: "theme\ndefault_mode locked\n", want: `line 2: bare word "locked"`},
+		{name: "kdl unclosed string", format: config.FormatKDL, content: "a \"b\nc 1\n", want: "line 1: string is never closed"},
+		{name: "kdl bad number", format: config.FormatKDL, content: "a 1.2.3\n", want: `bad number "1.2.3"`},
+		{name: "kdl zellij", format: config.FormatKDL, content: "keybinds {\n  normal {\n    bind \"Ctrl a\" { NoSuchAction; }\n  }\n}\n", want: "zellij:", tool: "zellij"},
+		{name: "zsh", format: config.FormatZsh, content: "if true; then\n  echo hi\nfi\n", tool: "zsh"},
+		{name: "zsh unclosed if", format: config.FormatZsh, content: "if true; then\n  echo hi\n", want: "zsh:", tool: "zsh"},
+		{name: "tmux", format: config.FormatTmux, content: "set -g mouse on\nrun 'exit 1'\n", tool: "tmux"},
+		{name: "tmux unknown command", format: config.FormatTmux, content: "set -g mouse on\nbogus-command\n", want: "line 2: unknown command", tool: "tmux"},
+		{name: "none", format: config.FormatNone, content: "{{ anything"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.tool != "" {
+				if _, err := exec.LookPath(tc.tool); err != nil {
+					t.Skipf("%s not installed", tc.tool)
+				}
+			}
+			err := validateDotfile(context.Background(), tc.format, []byte(tc.content))
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Fatalf("got %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestTmuxVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		version string
+		want    bool
+	}{
+		{"tmux 3.3a", true},
+		{"tmux 3.2", true},
+		{"tmux 3.1c", false},
+		{"tmux 2.9", false},
+		{"tmux 10.0", true},
+		{"tmux next-3.4", true},
+		{"tmux master", true},
+	}
+	for _, tc := range cases {
+		if got := tmuxVersionAtLeast(tc.version, 3, 2); got != tc.want {
+			t.Errorf("tmuxVersionAtLeast(%q, 3, 2) = %v, want %v", tc.version, got, tc.want)
+		}
+	}
+}
+
+// TestCheckKDLEmbedded runs the built-in syntax check alone, so the Zellij
+// config is checked on machines without zellij too.
+func TestCheckKDLEmbedded(t *testing.T) {
+	data, err := fs.ReadFile(configs.FS, "zellij.kdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkKDL(data); err != nil {
+		t.Fatalf("zellij.kdl: %v", err)
+	}
+	if err := checkKDL(append(data, "\nkeybinds {\n"...)); err == nil {
+		t.Fatal("zellij.kdl with an unclosed block passed")
+	}
+}
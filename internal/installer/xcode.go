@@ -2,6 +2,7 @@ package installer
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"macsetup/internal/utils"
@@ -23,10 +24,18 @@ func WaitForXcode(ctx context.Context, pollInterval time.Duration) error {
 	}
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
+	start := time.Now()
+	lastNote := start
+	// Keep the failing xcode-select polls out of the streamed output.
+	quiet := utils.WithLineHandler(ctx, nil)
 	for {
-		if IsXcodeInstalled(ctx) {
+		if IsXcodeInstalled(quiet) {
 			return nil
 		}
+		if time.Since(lastNote) >= 30*time.Second {
+			lastNote = time.Now()
+			utils.EmitLine(ctx, fmt.Sprintf("Still waiting for the Command Line Tools installer (%s elapsed)", time.Since(start).Round(time.Second)))
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
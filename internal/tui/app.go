@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"macsetup/internal/config"
 	"macsetup/internal/installer"
+	"macsetup/internal/utils"
 
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -30,6 +32,9 @@ const (
 	StateHelp
 )
 
+// outputTailLines is how many output lines are shown under each running step.
+const outputTailLines = 3
+
 type Model struct {
 	ctx       context.Context
 	state     AppState
@@ -37,6 +42,7 @@ type Model struct {
 	height    int
 	workers   int
 	verbose   bool
+	opts      installer.RunOptions
 	err       error
 	startTime time.Time
 
@@ -47,6 +53,11 @@ type Model struct {
 	selected  map[string]bool
 	collapsed map[string]bool
 
+	// dotfiles are the files the dotfiles source provides, listed under the
+	// "dotfiles" category; dotfileOn holds which of them to write.
+	dotfiles  []installer.DotfileEntry
+	dotfileOn map[string]bool
+
 	cursor       int
 	scrollOffset int
 	listItems    []listItem
@@ -55,6 +66,7 @@ type Model struct {
 	bar  progress.Model
 
 	progressUpdates <-chan installer.ProgressUpdate
+	outputUpdates   <-chan installer.OutputEvent
 	installDoneCh   <-chan installer.Summary
 	installErrCh    <-chan error
 	results         []installer.InstallResult
@@ -63,43 +75,58 @@ type Model struct {
 	completedPackages int
 
 	// Track packages by state
-	installedPackages map[string]string // name -> message
-	failedPackages    map[string]string // name -> error
-	runningPackages   map[string]string // name -> message
+	installedPackages map[string]string   // name -> message
+	failedPackages    map[string]string   // name -> error
+	runningPackages   map[string]string   // name -> message
+	outputTails       map[string][]string // name -> last lines of output
+
+	// stopInstall asks the run to finish its running steps and start no
+	// more; killInstall stops them too. stopping is set after the first.
+	stopInstall func()
+	killInstall func()
+	stopping    bool
 
 	logger io.Writer
 
 	previousState AppState
 }
 
+// dotfilesCategory lists the dotfiles instead of packages.
+const dotfilesCategory = "dotfiles"
+
 type listItem struct {
 	isCategory      bool
 	isSubCategory   bool
 	subCategoryName string
 	category        *config.Category
 	pkg             *config.Package
+	dotfile         *installer.DotfileEntry
 }
 
 type (
 	installDoneMsg    installer.Summary
 	xcodeReadyMsg     struct{}
 	scanFinishedMsg   map[string]bool
+	dotfilesListedMsg []installer.DotfileEntry
 	installStartedMsg struct {
 		updates <-chan installer.ProgressUpdate
+		output  <-chan installer.OutputEvent
 		done    <-chan installer.Summary
 		errs    <-chan error
+		stop    func()
+		kill    func()
 	}
 )
 type errMsg struct{ err error }
 
-func Run(ctx context.Context, workers int, verbose bool, logger io.Writer) error {
-	m := newModel(ctx, workers, verbose, logger)
+func Run(ctx context.Context, workers int, opts installer.RunOptions, logger io.Writer) error {
+	m := newModel(ctx, workers, opts, logger)
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx))
 	_, err := p.Run()
 	return err
 }
 
-func newModel(ctx context.Context, workers int, verbose bool, logger io.Writer) Model {
+func newModel(ctx context.Context, workers int, opts installer.RunOptions, logger io.Writer) Model {
 	spin := spinner.New()
 	spin.Spinner = spinner.Dot
 
@@ -109,16 +136,19 @@ func newModel(ctx context.Context, workers int, verbose bool, logger io.Writer)
 		ctx:               ctx,
 		state:             StateWelcome,
 		workers:           workers,
-		verbose:           verbose,
+		verbose:           opts.Verbose,
+		opts:              opts,
 		categories:        config.Categories(),
 		packages:          config.AllPackages(),
 		selected:          config.DefaultSelection(),
 		collapsed:         make(map[string]bool),
+		dotfileOn:         make(map[string]bool),
 		spin:              spin,
 		bar:               bar,
 		installedPackages: make(map[string]string),
 		failedPackages:    make(map[string]string),
 		runningPackages:   make(map[string]string),
+		outputTails:       make(map[string][]string),
 		logger:            logger,
 	}
 
@@ -145,10 +175,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case installer.ProgressUpdate:
 		m = m.applyUpdate(msg)
 		return m, m.waitForUpdate()
+	case installer.OutputEvent:
+		m = m.applyOutput(msg)
+		return m, m.waitForOutput()
 	case installStartedMsg:
 		m.progressUpdates = msg.updates
+		m.outputUpdates = msg.output
 		m.installDoneCh = msg.done
 		m.installErrCh = msg.errs
+		m.stopInstall = msg.stop
+		m.killInstall = msg.kill
 		// Count total packages to install
 		m.totalPackages = 0
 		for _, selected := range m.selected {
@@ -157,12 +193,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 		m.completedPackages = 0
-		return m, tea.Batch(m.waitForUpdate(), m.waitForDone(), m.spin.Tick)
+		return m, tea.Batch(m.waitForUpdate(), m.waitForOutput(), m.waitForDone(), m.spin.Tick)
 	case installDoneMsg:
+		m.killInstall()
 		m.state = StateSummary
 		m.results = msg.Results
 		return m, nil
 	case errMsg:
+		if m.killInstall != nil {
+			m.killInstall()
+		}
 		m.err = msg.err
 		m.state = StateSummary
 		return m, nil
@@ -187,6 +227,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.state = StateSelection
 		return m, nil
+	case dotfilesListedMsg:
+		m.dotfiles = msg
+		chosen := m.opts.Dotfiles.Files
+		for _, f := range m.dotfiles {
+			m.dotfileOn[f.Name] = chosen == nil || slices.Contains(chosen, f.Name)
+		}
+		m.rebuildList()
+		return m, nil
 	}
 
 	if m.state == StateInstalling || m.state == StateScanning {
@@ -200,6 +248,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "ctrl+c", "q":
+		if m.state == StateInstalling && m.stopInstall != nil {
+			// Quit once the summary is in: first wind down, then kill.
+			if !m.stopping {
+				m.stopping = true
+				m.stopInstall()
+			} else {
+				m.killInstall()
+			}
+			return m, nil
+		}
 		return m, tea.Quit
 	case "?":
 		if m.state != StateHelp {
@@ -220,7 +278,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case StateWelcome:
 		if msg.String() == "enter" {
 			m.state = StateScanning
-			return m, m.startScan()
+			return m, tea.Batch(m.startScan(), m.listDotfiles())
 		}
 	case StateSelection:
 		switch msg.String() {
@@ -242,7 +300,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.selectCategoryAtCursor(false)
 		case "enter":
 			m.startTime = time.Now()
-			if installer.IsXcodeInstalled(m.ctx) {
+			if !utils.IsMacOS() || installer.IsXcodeInstalled(m.ctx) {
 				m.state = StateInstalling
 				return m, m.startInstall()
 			}
@@ -290,6 +348,10 @@ func (m *Model) toggleCurrent() {
 		return
 	}
 
+	if item.dotfile != nil {
+		m.dotfileOn[item.dotfile.Name] = !m.dotfileOn[item.dotfile.Name]
+		return
+	}
 	if item.pkg == nil {
 		return
 	}
@@ -310,10 +372,19 @@ func (m *Model) selectCategoryAtCursor(on bool) {
 		catKey = item.category.Key
 	} else if item.pkg != nil {
 		catKey = item.pkg.Category
+	} else if item.dotfile != nil {
+		catKey = dotfilesCategory
 	} else {
 		return
 	}
 
+	if catKey == dotfilesCategory {
+		for _, f := range m.dotfiles {
+			m.dotfileOn[f.Name] = on
+		}
+		return
+	}
+
 	for _, c := range m.categories {
 		if c.Key == catKey && (c.Required || !c.Selectable) {
 			return
@@ -374,6 +445,9 @@ func (m *Model) rebuildList() {
 		if cat.Key == "installed" && len(pkgs) == 0 {
 			continue
 		}
+		if cat.Key == dotfilesCategory && len(m.dotfiles) == 0 {
+			continue
+		}
 
 		c := cat
 		items = append(items, listItem{isCategory: true, category: &c})
@@ -382,6 +456,13 @@ func (m *Model) rebuildList() {
 			continue
 		}
 
+		if cat.Key == dotfilesCategory {
+			for i := range m.dotfiles {
+				items = append(items, listItem{dotfile: &m.dotfiles[i]})
+			}
+			continue
+		}
+
 		// Group by SubCategory
 		subCats := map[string][]config.Package{}
 		var subCatKeys []string
@@ -430,21 +511,43 @@ func (m Model) startScan() tea.Cmd {
 	}
 }
 
+// listDotfiles reads which files the dotfiles source provides. Without the
+// list (say, a git source that cannot be cloned) the category stays hidden
+// and the run writes what the flags and config choose.
+func (m Model) listDotfiles() tea.Cmd {
+	return func() tea.Msg {
+		entries, _ := installer.ListDotfiles(m.ctx, m.opts.Dotfiles)
+		return dotfilesListedMsg(entries)
+	}
+}
+
 func (m Model) startInstall() tea.Cmd {
+	opts := m.opts
+	if len(m.dotfiles) > 0 {
+		opts.Dotfiles.Files = []string{}
+		for _, f := range m.dotfiles {
+			if m.dotfileOn[f.Name] {
+				opts.Dotfiles.Files = append(opts.Dotfiles.Files, f.Name)
+			}
+		}
+	}
 	return func() tea.Msg {
-		manager := installer.NewManager(m.workers, installer.RunOptions{Verbose: m.verbose})
+		manager := installer.NewManager(m.workers, opts)
 		updates := manager.Progress()
+		output := manager.Output()
 		done := make(chan installer.Summary, 1)
 		errs := make(chan error, 1)
+		ctx, kill := context.WithCancel(m.ctx)
+		ctx, stop := installer.WithStop(ctx)
 		go func() {
-			summary, err := manager.Run(m.ctx, m.selected)
+			summary, err := manager.Run(ctx, m.selected)
 			if err != nil {
 				errs <- err
 				return
 			}
 			done <- summary
 		}()
-		return installStartedMsg{updates: updates, done: done, errs: errs}
+		return installStartedMsg{updates: updates, output: output, done: done, errs: errs, stop: stop, kill: kill}
 	}
 }
 
@@ -472,6 +575,10 @@ func (m Model) applyUpdate(upd installer.ProgressUpdate) Model {
 		}
 	}
 
+	if upd.Status != installer.StatusRunning {
+		delete(m.outputTails, pkgName)
+	}
+
 	switch upd.Status {
 	case installer.StatusRunning:
 		// Remove from other states if present
@@ -479,7 +586,10 @@ func (m Model) applyUpdate(upd installer.ProgressUpdate) Model {
 		delete(m.failedPackages, pkgName)
 		// Add to running
 		m.runningPackages[pkgName] = upd.Message
-	case installer.StatusInstalled, installer.StatusSkipped:
+	case installer.StatusPending:
+		// Prefetched; waiting for its install slot
+		delete(m.runningPackages, pkgName)
+	case installer.StatusInstalled, installer.StatusSkipped, installer.StatusAdopted:
 		// Remove from running
 		delete(m.runningPackages, pkgName)
 		// Add to installed
@@ -491,10 +601,36 @@ func (m Model) applyUpdate(upd installer.ProgressUpdate) Model {
 		// Add to failed
 		m.failedPackages[pkgName] = upd.Error
 		m.completedPackages++
+	case installer.StatusCancelled:
+		delete(m.runningPackages, pkgName)
+	}
+	return m
+}
+
+// applyOutput keeps the last few output lines of each running step.
+func (m Model) applyOutput(ev installer.OutputEvent) Model {
+	name := ev.Package.Name
+	tail := append(m.outputTails[name], ev.Line)
+	if len(tail) > outputTailLines {
+		tail = tail[len(tail)-outputTailLines:]
 	}
+	m.outputTails[name] = tail
 	return m
 }
 
+func (m Model) waitForOutput() tea.Cmd {
+	return func() tea.Msg {
+		if m.outputUpdates == nil {
+			return nil
+		}
+		ev, ok := <-m.outputUpdates
+		if !ok {
+			return nil
+		}
+		return ev
+	}
+}
+
 func (m Model) waitForUpdate() tea.Cmd {
 	return func() tea.Msg {
 		if m.progressUpdates == nil {
@@ -553,7 +689,7 @@ const helpMarkdown = `
 - **a**: Select all in section
 - **n**: Deselect all in section
 - **?**: Toggle this help view
-- **q / Ctrl+C**: Quit
+- **q / Ctrl+C**: Quit; while installing, stop after the running steps (press again to stop them too)
 
 ## Symbols
 - ` + "`[ ]`" + `: Not selected
@@ -616,6 +752,14 @@ func selectionView(m Model) string {
 		if item.isCategory && item.category != nil {
 			cat := item.category
 			countSel := selectedCount(m.selected, m.packages, cat.Key)
+			if cat.Key == dotfilesCategory {
+				countSel = 0
+				for _, f := range m.dotfiles {
+					if m.dotfileOn[f.Name] {
+						countSel++
+					}
+				}
+			}
 
 			collapseIcon := "[-]"
 			if m.collapsed[cat.Key] {
@@ -640,6 +784,15 @@ func selectionView(m Model) string {
 			continue
 		}
 
+		if item.dotfile != nil {
+			ch := "[ ]"
+			if m.dotfileOn[item.dotfile.Name] {
+				ch = okStyle.Render("[x]")
+			}
+			b.WriteString(fmt.Sprintf("%s  %s %s%s\n", cursor, ch, item.dotfile.Name, dimStyle.Render(" → "+utils.ShortenHome(item.dotfile.Dest))))
+			continue
+		}
+
 		if item.pkg != nil {
 			pkg := item.pkg
 
@@ -754,15 +907,26 @@ func installingView(m Model) string {
 		b.WriteString("\n")
 	}
 
-	// Section 3: Currently running packages
+	// Section 3: Currently running packages, each with a tail of its output
 	if len(m.runningPackages) > 0 {
-		for name, msg := range m.runningPackages {
+		var names []string
+		for name := range m.runningPackages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			msg := m.runningPackages[name]
 			line := m.spin.View() + " " + name
 			if msg != "" {
 				line += dimStyle.Render(" (" + msg + ")")
 			}
 			b.WriteString(line)
 			b.WriteString("\n")
+			for _, out := range m.outputTails[name] {
+				b.WriteString(dimStyle.Render("    │ " + truncate(out, m.width-6)))
+				b.WriteString("\n")
+			}
 		}
 		b.WriteString("\n")
 	}
@@ -775,7 +939,11 @@ func installingView(m Model) string {
 	b.WriteString(m.bar.ViewAs(percent))
 	b.WriteString(fmt.Sprintf("  %d/%d packages\n\n", m.completedPackages, m.totalPackages))
 
-	b.WriteString(dimStyle.Render("This may take a while. Press q to quit.\n"))
+	if m.stopping {
+		b.WriteString(badStyle.Render("Stopping: waiting for running steps to finish. Press q again to stop them now.\n"))
+	} else {
+		b.WriteString(dimStyle.Render("This may take a while. Press q to stop after the running steps.\n"))
+	}
 	return b.String()
 }
 
@@ -783,11 +951,15 @@ func summaryView(m Model) string {
 	if m.err != nil {
 		return badStyle.Render("Error: "+m.err.Error()) + "\n\nPress Enter to exit.\n"
 	}
-	var ok, skipped, failed int
+	var ok, skipped, failed, adopted, cancelled int
 	for _, r := range m.results {
 		switch r.Status {
+		case installer.StatusCancelled:
+			cancelled++
 		case installer.StatusInstalled:
 			ok++
+		case installer.StatusAdopted:
+			adopted++
 		case installer.StatusSkipped:
 			skipped++
 		case installer.StatusFailed:
@@ -801,15 +973,37 @@ func summaryView(m Model) string {
 	var b strings.Builder
 	b.WriteString(titleStyle.Render("Summary"))
 	b.WriteString("\n\n")
-	b.WriteString(fmt.Sprintf("%s %d installed  %s %d skipped  %s %d failed  (%s)\n\n",
+	b.WriteString(fmt.Sprintf("%s %d installed  %s %d adopted  %s %d skipped  %s %d failed  (%s)\n\n",
 		okStyle.Render("+"),
 		ok,
+		okStyle.Render("⇄"),
+		adopted,
 		dimStyle.Render("✓"),
 		skipped,
 		badStyle.Render("!"),
 		failed,
 		elapsed,
 	))
+	if cancelled > 0 {
+		b.WriteString(badStyle.Render(fmt.Sprintf("Interrupted: %d steps were not started:\n", cancelled)))
+		for _, r := range m.results {
+			if r.Status == installer.StatusCancelled {
+				b.WriteString(fmt.Sprintf("- %s\n", r.Package.Name))
+			}
+		}
+		b.WriteString("\n")
+	}
+	if m.opts.Checkpoint != "" {
+		if err := (installer.Summary{Results: m.results}).CheckpointError(); err != "" {
+			b.WriteString(badStyle.Render(fmt.Sprintf("Checkpoint could not be saved to %s: %s", m.opts.Checkpoint, err)) + "\n\n")
+		} else {
+			b.WriteString(dimStyle.Render("Checkpoint saved to "+m.opts.Checkpoint) + "\n\n")
+		}
+	}
+	if download, install := (installer.Summary{Results: m.results}).BrewTimes(); download > 0 {
+		b.WriteString(dimStyle.Render(fmt.Sprintf("Homebrew: %s downloading (in parallel), %s installing\n\n",
+			download.Round(time.Second), install.Round(time.Second))))
+	}
 
 	var installedBrew []config.Package
 	var installedTasks []config.Package
@@ -841,6 +1035,17 @@ func summaryView(m Model) string {
 		b.WriteString(dimStyle.Render("Full reference list: docs/packages.md\n\n"))
 	}
 
+	if adopted > 0 {
+		b.WriteString(okStyle.Render("Adopted apps (now managed by Homebrew):\n"))
+		for _, r := range m.results {
+			if r.Status != installer.StatusAdopted {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("- %s — %s\n", r.Package.Name, r.Message))
+		}
+		b.WriteString("\n")
+	}
+
 	if len(installedTasks) > 0 {
 		b.WriteString(dimStyle.Render("Setup tasks completed (this session):\n"))
 		for _, pkg := range installedTasks {
@@ -856,6 +1061,15 @@ func summaryView(m Model) string {
 				continue
 			}
 			b.WriteString(fmt.Sprintf("- %s: %s\n", r.Package.Name, r.Error))
+			for _, ca := range r.Retries {
+				if ca.Attempts <= 1 {
+					continue
+				}
+				b.WriteString(dimStyle.Render(fmt.Sprintf("  %s failed %d attempts:\n", ca.Command, ca.Attempts)))
+				for _, e := range ca.Errors {
+					b.WriteString(dimStyle.Render("  · "+truncate(strings.SplitN(e, "\n", 2)[0], 100)) + "\n")
+				}
+			}
 		}
 		b.WriteString("\n")
 	}
@@ -874,6 +1088,18 @@ func brewPackageLink(pkg config.Package) string {
 	}
 }
 
+// truncate shortens s to width runes; a width of 0 or less leaves it alone.
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 0 || len(r) <= width {
+		return s
+	}
+	if width == 1 {
+		return "…"
+	}
+	return string(r[:width-1]) + "…"
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// integrityPrefix starts every IntegrityError message so the class survives
+// being flattened to a string.
+const integrityPrefix = "integrity check failed"
+
+// IntegrityError reports a download or checkout that does not match the digest
+// or ref it was pinned to.
+type IntegrityError struct {
+	Source string
+	Want   string
+	Got    string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s for %s: expected %s, got %s", integrityPrefix, e.Source, e.Want, e.Got)
+}
+
+// VerifySHA256 checks the file at path against want (hex, case-insensitive).
+// An empty want accepts any content.
+func VerifySHA256(path, source, want string) error {
+	if want == "" {
+		return nil
+	}
+	got, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return &IntegrityError{Source: source, Want: "sha256 " + want, Got: "sha256 " + got}
+	}
+	return nil
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 digest of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
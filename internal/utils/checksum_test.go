@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifySHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.sh")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const sum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+	if err := VerifySHA256(path, "install.sh", ""); err != nil {
+		t.Fatalf("unpinned: %v", err)
+	}
+	if err := VerifySHA256(path, "install.sh", sum); err != nil {
+		t.Fatalf("matching digest: %v", err)
+	}
+	err := VerifySHA256(path, "install.sh", "00"+sum[2:])
+	var ie *IntegrityError
+	if !errors.As(err, &ie) {
+		t.Fatalf("expected IntegrityError, got %v", err)
+	}
+	if ie.Got != "sha256 "+sum {
+		t.Fatalf("Got = %q", ie.Got)
+	}
+}
@@ -1,56 +1,195 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"regexp"
 )
 
 type InstallErrorType string
 
 const (
-	ErrNetwork    InstallErrorType = "network"
-	ErrPermission InstallErrorType = "permission"
-	ErrDependency InstallErrorType = "dependency"
-	ErrNotFound   InstallErrorType = "not_found"
-	ErrTimeout    InstallErrorType = "timeout"
-	ErrLock       InstallErrorType = "lock"
-	ErrUnknown    InstallErrorType = "unknown"
+	ErrNetwork      InstallErrorType = "network"
+	ErrPermission   InstallErrorType = "permission"
+	ErrDependency   InstallErrorType = "dependency"
+	ErrNotFound     InstallErrorType = "not_found"
+	ErrTimeout      InstallErrorType = "timeout"
+	ErrStall        InstallErrorType = "stalled"
+	ErrLock         InstallErrorType = "lock"
+	ErrIntegrity    InstallErrorType = "integrity"
+	ErrAppExists    InstallErrorType = "app_exists"
+	ErrLinkConflict InstallErrorType = "link_conflict"
+	ErrXcodeLicense InstallErrorType = "xcode_license"
+	ErrDiskFull     InstallErrorType = "disk_full"
+	ErrSSL          InstallErrorType = "ssl"
+	ErrWrongPrefix  InstallErrorType = "wrong_prefix"
+	ErrUnknown      InstallErrorType = "unknown"
+)
+
+// FixAction names a remediation the installer can apply on its own before
+// giving up on a step. The installer maps each action to code; utils only
+// knows which errors call for which action.
+type FixAction string
+
+const (
+	// FixAdoptApp handles an app that exists outside Homebrew according to
+	// the adoption policy.
+	FixAdoptApp FixAction = "adopt-app"
+	// FixClearDownload removes a corrupt cached download and retries.
+	FixClearDownload FixAction = "clear-download"
+	// FixLink links the formula over the conflicting files.
+	FixLink FixAction = "link"
 )
 
 type InstallError struct {
 	Package string
 	Type    InstallErrorType
 	Message string
-	Stderr  string
+	// Hint tells the user how to fix the problem by hand, if we know.
+	Hint   string
+	Fix    FixAction
+	Stderr string
 }
 
 func (e *InstallError) Error() string {
+	if e.Hint != "" {
+		return fmt.Sprintf("[%s] %s: %s (%s)", e.Type, e.Package, e.Message, e.Hint)
+	}
 	return fmt.Sprintf("[%s] %s: %s", e.Type, e.Package, e.Message)
 }
 
+// Rule recognises one kind of failure. It matches when Err accepts the error
+// value or Pattern matches the output; the first matching rule wins.
+type Rule struct {
+	Type    InstallErrorType
+	Err     func(error) bool
+	Pattern *regexp.Regexp
+	// Message summarises the failure; empty keeps the error text, for
+	// failures whose details matter.
+	Message string
+	Hint    string
+	Fix     FixAction
+}
+
+func (r Rule) matches(err error, stderr string) bool {
+	return (r.Err != nil && r.Err(err)) || (r.Pattern != nil && r.Pattern.MatchString(stderr))
+}
+
+// rules is ordered from the most to the least specific: an SSL failure also
+// prints "Failed to download resource", and almost anything can mention a
+// dependency.
+var rules = []Rule{
+	{
+		Type: ErrIntegrity,
+		Err: func(err error) bool {
+			var integrity *IntegrityError
+			return errors.As(err, &integrity)
+		},
+		Pattern: regexp.MustCompile(regexp.QuoteMeta(integrityPrefix)),
+		Hint:    "the pinned sha256 or ref in your config no longer matches the source",
+	},
+	{
+		Type:    ErrStall,
+		Err:     func(err error) bool { return errors.Is(err, ErrCommandStalled) },
+		Pattern: regexp.MustCompile(regexp.QuoteMeta(ErrCommandStalled.Error())),
+		Message: "No output for too long - the command was stopped",
+		Hint:    "raise the stall limit under \"timeouts\" in the config if this step is just slow",
+	},
+	{
+		Type:    ErrTimeout,
+		Err:     func(err error) bool { return errors.Is(err, ErrCommandTimedOut) || errors.Is(err, ErrDeadline) },
+		Pattern: regexp.MustCompile(regexp.QuoteMeta(ErrCommandTimedOut.Error()) + "|" + regexp.QuoteMeta(ErrDeadline.Error())),
+	},
+	{
+		Type:    ErrWrongPrefix,
+		Pattern: regexp.MustCompile(`Cannot install in Homebrew on ARM processor in Intel default prefix`),
+		Message: "Homebrew in /usr/local is the Intel installation and cannot install ARM packages",
+		Hint:    "install Homebrew in /opt/homebrew and put it first in PATH",
+	},
+	{
+		Type:    ErrXcodeLicense,
+		Pattern: regexp.MustCompile(`(?i)agreed? to the Xcode(/iOS)? license|xcodebuild -license`),
+		Message: "The Xcode license has not been accepted",
+		Hint:    "run `sudo xcodebuild -license accept` and try again",
+	},
+	{
+		Type:    ErrDiskFull,
+		Pattern: regexp.MustCompile(`No space left on device`),
+		Message: "The disk is full",
+		Hint:    "free some space (`brew cleanup --prune=all` helps) and try again",
+	},
+	{
+		Type:    ErrSSL,
+		Pattern: regexp.MustCompile(`SSL certificate problem|server certificate verification failed|SSL_ERROR_|certificate verify failed`),
+		Message: "TLS certificate verification failed",
+		Hint:    "a proxy that intercepts TLS needs its CA in the system keychain; check the network settings in the config",
+	},
+	{
+		Type:    ErrIntegrity,
+		Pattern: regexp.MustCompile(`SHA256 mismatch|Checksum mismatch`),
+		Message: "The downloaded file does not match its checksum",
+		Fix:     FixClearDownload,
+	},
+	{
+		Type:    ErrAppExists,
+		Pattern: regexp.MustCompile(`It seems there is already an? (App|Binary|Font) at`),
+		Message: "The app already exists outside Homebrew",
+		Hint:    "use --adopt adopt (or replace) to hand it over to Homebrew",
+		Fix:     FixAdoptApp,
+	},
+	{
+		Type:    ErrLinkConflict,
+		Pattern: regexp.MustCompile("The `brew link` step did not complete successfully|Could not symlink"),
+		Message: "Installed, but files from another install are in the way of linking it",
+		Hint:    "run `brew link --overwrite <formula>`",
+		Fix:     FixLink,
+	},
+	{
+		Type: ErrNetwork,
+		Pattern: regexp.MustCompile(`Could not resolve host|Failed to connect to|Connection reset by peer|Connection refused|` +
+			`Operation timed out|Failed to download resource|The requested URL returned error: 5\d\d`),
+		Message: "Network error - check your internet connection",
+	},
+	{
+		Type:    ErrLock,
+		Pattern: regexp.MustCompile(`Another active Homebrew (\w+ )?process is already in progress|waiting for lock`),
+		Message: "Homebrew is locked by another brew process",
+		Hint:    "wait for the other brew command to finish",
+	},
+	{
+		Type:    ErrPermission,
+		Pattern: regexp.MustCompile(`Permission denied|Operation not permitted`),
+		Message: "Permission denied - check macOS Seatbelt or try running with sudo",
+		Hint:    "make sure you own the Homebrew prefix: `sudo chown -R $(whoami) $(brew --prefix)/*`",
+	},
+	{
+		Type:    ErrNotFound,
+		Pattern: regexp.MustCompile(`No available formula|No Cask with this name exists|is unavailable: No Cask`),
+		Message: "Package not found in Homebrew",
+		Hint:    "check the name with `brew search`; it may have been renamed or need a tap",
+	},
+	{
+		Type:    ErrDependency,
+		Pattern: regexp.MustCompile(`(?i)dependency`),
+		Message: "Dependency conflict",
+	},
+}
+
+// ClassifyError finds the rule for a failure from the error and the command's
+// output. Failures no rule knows are ErrUnknown.
 func ClassifyError(pkg string, err error, stderr string) *InstallError {
-	ie := &InstallError{Package: pkg, Stderr: stderr}
-
-	switch {
-	case strings.Contains(stderr, "Could not resolve host"):
-		ie.Type = ErrNetwork
-		ie.Message = "Network error - check your internet connection"
-	case strings.Contains(stderr, "Permission denied") || strings.Contains(stderr, "Operation not permitted"):
-		ie.Type = ErrPermission
-		ie.Message = "Permission denied - check macOS Seatbelt or try running with sudo"
-	case strings.Contains(stderr, "No available formula"):
-		ie.Type = ErrNotFound
-		ie.Message = "Package not found in Homebrew"
-	case strings.Contains(strings.ToLower(stderr), "dependency"):
-		ie.Type = ErrDependency
-		ie.Message = "Dependency conflict"
-	case strings.Contains(stderr, "Another active Homebrew process is already in progress") || strings.Contains(stderr, "waiting for lock"):
-		ie.Type = ErrLock
-		ie.Message = "Homebrew is locked by another process (internal mutex should handle this)"
-	default:
-		ie.Type = ErrUnknown
-		ie.Message = err.Error()
+	ie := &InstallError{Package: pkg, Stderr: stderr, Type: ErrUnknown, Message: err.Error()}
+	for _, r := range rules {
+		if !r.matches(err, stderr) {
+			continue
+		}
+		ie.Type = r.Type
+		if r.Message != "" {
+			ie.Message = r.Message
+		}
+		ie.Hint = r.Hint
+		ie.Fix = r.Fix
+		break
 	}
-
 	return ie
 }
@@ -2,6 +2,9 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -21,6 +24,13 @@ func TestClassifyError(t *testing.T) {
 			wantMsg:   "Network error - check your internet connection",
 			wantInErr: "[network]",
 		},
+		{
+			name:      "connection reset",
+			stderr:    "curl: (56) Recv failure: Connection reset by peer",
+			wantType:  ErrNetwork,
+			wantMsg:   "Network error - check your internet connection",
+			wantInErr: "[network]",
+		},
 		{
 			name:      "permission",
 			stderr:    "Permission denied",
@@ -59,3 +69,80 @@ func TestClassifyError(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifyIntegrityError(t *testing.T) {
+	err := fmt.Errorf("failed to clone tpm: %w", &IntegrityError{Source: "https://example.com/tpm.git", Want: "ref v9", Got: "no such ref"})
+	if ie := ClassifyError("tpm", err, ""); ie.Type != ErrIntegrity {
+		t.Fatalf("wrapped error: got %q want %q", ie.Type, ErrIntegrity)
+	}
+	// The manager only keeps the error text; the class must survive that.
+	flat := errors.New(err.Error())
+	if ie := ClassifyError("tpm", flat, flat.Error()); ie.Type != ErrIntegrity {
+		t.Fatalf("flattened error: got %q want %q", ie.Type, ErrIntegrity)
+	}
+}
+
+func TestClassifyTimeoutErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want InstallErrorType
+	}{
+		{name: "timeout", err: fmt.Errorf("%w: brew [install llvm]", ErrCommandTimedOut), want: ErrTimeout},
+		{name: "deadline", err: fmt.Errorf("%w: brew [install llvm]", ErrDeadline), want: ErrTimeout},
+		{name: "stall", err: fmt.Errorf("%w (no output for 20m0s): brew [install llvm]", ErrCommandStalled), want: ErrStall},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if ie := ClassifyError("llvm", tc.err, ""); ie.Type != tc.want {
+				t.Fatalf("wrapped error: got %q want %q", ie.Type, tc.want)
+			}
+			flat := errors.New(tc.err.Error())
+			if ie := ClassifyError("llvm", flat, flat.Error()); ie.Type != tc.want {
+				t.Fatalf("flattened error: got %q want %q", ie.Type, tc.want)
+			}
+		})
+	}
+}
+
+func TestClassifyBrewStderr(t *testing.T) {
+	cases := []struct {
+		fixture  string
+		wantType InstallErrorType
+		wantFix  FixAction
+		wantHint bool
+	}{
+		{fixture: "brew-stderr-app-exists.txt", wantType: ErrAppExists, wantFix: FixAdoptApp, wantHint: true},
+		{fixture: "brew-stderr-xcode-license.txt", wantType: ErrXcodeLicense, wantHint: true},
+		{fixture: "brew-stderr-disk-full.txt", wantType: ErrDiskFull, wantHint: true},
+		{fixture: "brew-stderr-ssl.txt", wantType: ErrSSL, wantHint: true},
+		{fixture: "brew-stderr-checksum.txt", wantType: ErrIntegrity, wantFix: FixClearDownload},
+		{fixture: "brew-stderr-arm-prefix.txt", wantType: ErrWrongPrefix, wantHint: true},
+		{fixture: "brew-stderr-link-conflict.txt", wantType: ErrLinkConflict, wantFix: FixLink, wantHint: true},
+		{fixture: "brew-stderr-update-lock.txt", wantType: ErrLock, wantHint: true},
+		{fixture: "brew-stderr-cask-unavailable.txt", wantType: ErrNotFound, wantHint: true},
+		{fixture: "brew-stderr-permission.txt", wantType: ErrPermission, wantHint: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stderr := string(data)
+			ie := ClassifyError("pkg", errors.New("exit status 1: "+stderr), stderr)
+			if ie.Type != tc.wantType {
+				t.Fatalf("type: got %q want %q", ie.Type, tc.wantType)
+			}
+			if ie.Fix != tc.wantFix {
+				t.Fatalf("fix: got %q want %q", ie.Fix, tc.wantFix)
+			}
+			if (ie.Hint != "") != tc.wantHint {
+				t.Fatalf("hint: got %q", ie.Hint)
+			}
+			if tc.wantHint && !strings.Contains(ie.Error(), ie.Hint) {
+				t.Fatalf("error string %q does not carry the hint", ie.Error())
+			}
+		})
+	}
+}
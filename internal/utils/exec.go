@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,18 +18,105 @@ type CmdResult struct {
 	Stderr string
 }
 
+// Streams passed to a LineHandler. StreamInfo carries progress notes that do
+// not come from a command.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	StreamInfo   = "info"
+)
+
+// LineHandler receives output one line at a time, as it is written. Calls
+// for one command never overlap.
+type LineHandler func(stream, line string)
+
+type lineHandlerKey struct{}
+
+// WithLineHandler makes Run stream the output of commands started with the
+// returned context to h, in addition to collecting it in CmdResult.
+func WithLineHandler(ctx context.Context, h LineHandler) context.Context {
+	return context.WithValue(ctx, lineHandlerKey{}, h)
+}
+
+// EmitLine passes a progress note to ctx's line handler, if any.
+func EmitLine(ctx context.Context, line string) {
+	if h, _ := ctx.Value(lineHandlerKey{}).(LineHandler); h != nil {
+		h(StreamInfo, line)
+	}
+}
+
+// Errors Run returns when a command is cut short. ErrDeadline is the cause
+// callers give the context of a whole run (see --deadline).
+var (
+	ErrCommandTimedOut = errors.New("command timed out")
+	ErrCommandStalled  = errors.New("command stalled")
+	ErrDeadline        = errors.New("run deadline reached")
+)
+
+// Limits bounds every command run with a context from WithLimits. Timeout
+// caps a command's run time (an explicit, shorter Run timeout still wins),
+// Stall kills a command that writes nothing for that long, and Retries is how
+// many extra attempts Retry grants after a timeout or stall.
+type Limits struct {
+	Timeout time.Duration
+	Stall   time.Duration
+	Retries int
+}
+
+// killWaitDelay is how long Run waits for output after killing a command.
+const killWaitDelay = 5 * time.Second
+
+type limitsKey struct{}
+
+// WithLimits applies l to every command run with the returned context.
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+// LimitsFrom returns the limits set on ctx, if any.
+func LimitsFrom(ctx context.Context) Limits {
+	l, _ := ctx.Value(limitsKey{}).(Limits)
+	return l
+}
+
 func Run(ctx context.Context, verbose bool, timeout time.Duration, name string, args ...string) (CmdResult, error) {
+	limits := LimitsFrom(ctx)
+	if limits.Timeout > 0 && (timeout <= 0 || limits.Timeout < timeout) {
+		timeout = limits.Timeout
+	}
 	if timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, timeout)
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrCommandTimedOut)
 		defer cancel()
 	}
 
-	cmd := exec.CommandContext(ctx, name, args...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	var out, errOut io.Writer = &stdout, &stderr
+	if h, _ := ctx.Value(lineHandlerKey{}).(LineHandler); h != nil {
+		mu := &sync.Mutex{}
+		outLines := &lineWriter{stream: StreamStdout, handle: h, mu: mu}
+		errLines := &lineWriter{stream: StreamStderr, handle: h, mu: mu}
+		out = io.MultiWriter(out, outLines)
+		errOut = io.MultiWriter(errOut, errLines)
+		defer outLines.Flush()
+		defer errLines.Flush()
+	}
+	if limits.Stall > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		w := newWatchdog(limits.Stall, func() { cancel(ErrCommandStalled) })
+		defer w.Stop()
+		out = io.MultiWriter(out, w)
+		errOut = io.MultiWriter(errOut, w)
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// A killed command's children can keep its pipes open; don't wait on them.
+	cmd.WaitDelay = killWaitDelay
+	cmd.Stdout = out
+	cmd.Stderr = errOut
 	err := cmd.Run()
 
 	res := CmdResult{Stdout: stdout.String(), Stderr: stderr.String()}
@@ -43,8 +133,95 @@ func Run(ctx context.Context, verbose bool, timeout time.Duration, name string,
 		return res, nil
 	}
 
-	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		return res, fmt.Errorf("command timed out: %s %v", name, args)
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, ErrCommandStalled):
+		return res, fmt.Errorf("%w (no output for %s): %s %v", ErrCommandStalled, limits.Stall, name, args)
+	case errors.Is(cause, ErrCommandTimedOut):
+		return res, fmt.Errorf("%w: %s %v", ErrCommandTimedOut, name, args)
+	case errors.Is(cause, ErrDeadline):
+		return res, fmt.Errorf("%w: %s %v", ErrDeadline, name, args)
 	}
 	return res, err
 }
+
+// watchdog calls fire once nothing has been written to it for the stall
+// period.
+type watchdog struct {
+	last  atomic.Int64 // unix nanos of the last write
+	stop  chan struct{}
+	once  sync.Once
+	stall time.Duration
+}
+
+func newWatchdog(stall time.Duration, fire func()) *watchdog {
+	w := &watchdog{stop: make(chan struct{}), stall: stall}
+	w.last.Store(time.Now().UnixNano())
+	tick := stall / 10
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	go func() {
+		t := time.NewTicker(tick)
+		defer t.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case now := <-t.C:
+				if now.Sub(time.Unix(0, w.last.Load())) >= w.stall {
+					fire()
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+func (w *watchdog) Write(p []byte) (int, error) {
+	w.last.Store(time.Now().UnixNano())
+	return len(p), nil
+}
+
+func (w *watchdog) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// lineWriter splits what a command writes into lines for a LineHandler. A
+// carriage return also ends a line so progress bars show up as they redraw.
+type lineWriter struct {
+	stream string
+	handle LineHandler
+	mu     *sync.Mutex // shared by a command's stdout and stderr
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes on a final line that had no newline.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.emit(w.buf)
+	w.buf = nil
+}
+
+func (w *lineWriter) emit(line []byte) {
+	if text := strings.TrimRight(string(line), " \t"); text != "" {
+		w.handle(w.stream, text)
+	}
+}
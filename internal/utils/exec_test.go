@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -22,3 +23,84 @@ func TestRunTimeout(t *testing.T) {
 		t.Fatalf("expected timeout error")
 	}
 }
+
+func TestRunStreamsLines(t *testing.T) {
+	var got []string
+	ctx := WithLineHandler(context.Background(), func(stream, line string) {
+		got = append(got, stream+": "+line)
+	})
+	res, err := Run(ctx, false, time.Second, "/bin/sh", "-c", `printf 'one\ntwo\r'; printf 'oops\n' >&2; printf 'three'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "one\ntwo\rthree" {
+		t.Fatalf("stdout: got %q", res.Stdout)
+	}
+	want := map[string]bool{"stdout: one": true, "stdout: two": true, "stderr: oops": true, "stdout: three": true}
+	if len(got) != len(want) {
+		t.Fatalf("got lines %q", got)
+	}
+	for _, line := range got {
+		if !want[line] {
+			t.Fatalf("unexpected line %q in %q", line, got)
+		}
+	}
+	if got[len(got)-1] != "stdout: three" {
+		t.Fatalf("unterminated last line not flushed last: %q", got)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		limits Limits
+		script string
+		want   error
+	}{
+		{
+			name:   "timeout",
+			limits: Limits{Timeout: 50 * time.Millisecond},
+			script: "exec sleep 2",
+			want:   ErrCommandTimedOut,
+		},
+		{
+			name:   "stall",
+			limits: Limits{Stall: 100 * time.Millisecond},
+			script: "printf a; sleep 0.05; printf b; exec sleep 2",
+			want:   ErrCommandStalled,
+		},
+		{
+			name:   "steady output is not a stall",
+			limits: Limits{Stall: 150 * time.Millisecond},
+			script: "for i in 1 2 3 4 5; do echo $i; sleep 0.05; done",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := WithLimits(context.Background(), tc.limits)
+			start := time.Now()
+			_, err := Run(ctx, false, 0, "/bin/sh", "-c", tc.script)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error: got %v want %v", err, tc.want)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Fatalf("command was not stopped promptly: took %s", d)
+			}
+		})
+	}
+}
+
+func TestRunDeadlineCause(t *testing.T) {
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 50*time.Millisecond, ErrDeadline)
+	defer cancel()
+	_, err := Run(ctx, false, time.Minute, "/bin/sh", "-c", "exec sleep 2")
+	if !errors.Is(err, ErrDeadline) {
+		t.Fatalf("error: got %v want %v", err, ErrDeadline)
+	}
+}
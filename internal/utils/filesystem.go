@@ -30,6 +30,16 @@ func ExpandHome(path string) (string, error) {
 	return "", fmt.Errorf("unsupported tilde path: %q", path)
 }
 
+// ShortenHome is the reverse of ExpandHome for display: a path inside the
+// home directory is written as ~/..., anything else is returned as is.
+func ShortenHome(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || !strings.HasPrefix(path, home+string(os.PathSeparator)) {
+		return path
+	}
+	return "~" + strings.TrimPrefix(path, home)
+}
+
 func Exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
@@ -71,10 +81,9 @@ func WriteWithBackup(dest string, content []byte, mode os.FileMode) (string, err
 
 	var backup string
 	if Exists(dest) {
-		backup = backupPath(dest)
-		if err := os.Rename(dest, backup); err != nil {
+		if backup, err = MoveToBackup(dest); err != nil {
 			cleanup()
-			return "", fmt.Errorf("failed to backup %s: %w", dest, err)
+			return "", err
 		}
 	}
 
@@ -88,11 +97,47 @@ func WriteWithBackup(dest string, content []byte, mode os.FileMode) (string, err
 	return backup, nil
 }
 
-func SymlinkIfMissing(linkPath, target string) error {
-	if _, err := os.Lstat(linkPath); err == nil {
-		return nil
+// SetSymlink makes linkPath a symlink to target, repointing a symlink that
+// is already there, wrong or dangling. Anything else at linkPath is left
+// alone and reported. The new link is swapped in with a rename, so an
+// existing link never goes missing. Whether a link may be repointed is up to
+// the caller.
+func SetSymlink(linkPath, target string) error {
+	if info, err := os.Lstat(linkPath); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s exists and is not a symlink", linkPath)
+	}
+	tmp := fmt.Sprintf("%s.tmp.%d", linkPath, time.Now().UnixNano())
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, linkPath); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// ReadLink returns the target of the symlink at path, made absolute against
+// the link's directory when it is relative.
+func ReadLink(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return filepath.Clean(target), nil
+}
+
+// MoveToBackup renames path to a new backup name next to it, as
+// WriteWithBackup does, and returns that name.
+func MoveToBackup(path string) (string, error) {
+	backup := backupPath(path)
+	if err := os.Rename(path, backup); err != nil {
+		return "", fmt.Errorf("failed to backup %s: %w", path, err)
 	}
-	return os.Symlink(target, linkPath)
+	return backup, nil
 }
 
 func backupPath(dest string) string {
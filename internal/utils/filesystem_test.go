@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -21,6 +22,21 @@ func TestExpandHome(t *testing.T) {
 	}
 }
 
+func TestShortenHome(t *testing.T) {
+	t.Setenv("HOME", "/home/u")
+	for path, want := range map[string]string{
+		"/home/u/.zshrc":         "~/.zshrc",
+		"/home/u/.config/a.toml": "~/.config/a.toml",
+		"/home/u":                "/home/u",
+		"/home/uv/.zshrc":        "/home/uv/.zshrc",
+		"/etc/zshrc":             "/etc/zshrc",
+	} {
+		if got := ShortenHome(path); got != want {
+			t.Errorf("ShortenHome(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
 func TestWriteWithBackup(t *testing.T) {
 	dir := t.TempDir()
 	dest := filepath.Join(dir, "file.txt")
@@ -67,17 +83,50 @@ func TestWriteWithBackupUnique(t *testing.T) {
 	}
 }
 
-func TestSymlinkIfMissing(t *testing.T) {
+func TestSetSymlink(t *testing.T) {
 	dir := t.TempDir()
 	target := filepath.Join(dir, "target")
-	link := filepath.Join(dir, "link")
 	if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	if err := SymlinkIfMissing(link, target); err != nil {
+	mine := filepath.Join(dir, "mine")
+	if err := os.WriteFile(mine, []byte("mine"), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	if err := SymlinkIfMissing(link, target); err != nil {
-		t.Fatal(err)
+
+	cases := []struct {
+		name    string
+		setup   func(link string) error
+		wantErr bool
+	}{
+		{name: "missing", setup: func(string) error { return nil }},
+		{name: "right target", setup: func(link string) error { return os.Symlink(target, link) }},
+		{name: "wrong target", setup: func(link string) error { return os.Symlink(mine, link) }},
+		{name: "dangling", setup: func(link string) error { return os.Symlink(filepath.Join(dir, "gone"), link) }},
+		{name: "file", setup: func(link string) error { return os.WriteFile(link, []byte("keep"), 0o644) }, wantErr: true},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			link := filepath.Join(dir, fmt.Sprintf("link%d", i))
+			if err := tc.setup(link); err != nil {
+				t.Fatal(err)
+			}
+			err := SetSymlink(link, target)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if data, _ := os.ReadFile(link); string(data) != "keep" {
+					t.Fatalf("file replaced, now %q", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ReadLink(link); err != nil || got != target {
+				t.Fatalf("link points at %q (%v), want %q", got, err, target)
+			}
+		})
 	}
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -12,8 +14,91 @@ type RetryOptions struct {
 	Attempts  int
 	BaseDelay time.Duration
 	MaxDelay  time.Duration
+	// Classify decides whether a failure is worth another attempt. Nil
+	// retries every failure.
+	Classify func(error) RetryDecision
 }
 
+// RetryDecision is what RetryOptions.Classify makes of a failure. MinDelay
+// raises the wait before the next attempt above the usual backoff (and above
+// MaxDelay).
+type RetryDecision struct {
+	Retry    bool
+	MinDelay time.Duration
+}
+
+// LockRetryDelay is the least Retry waits after Homebrew reported that
+// another brew process holds its lock; those usually run for a while.
+const LockRetryDelay = 15 * time.Second
+
+// RetryTransient retries the error classes that can go away on their own:
+// network failures, timeouts, stalls and Homebrew locks. Missing packages,
+// permission problems and the like fail on the first attempt.
+func RetryTransient(err error) RetryDecision {
+	switch ClassifyError("", err, err.Error()).Type {
+	case ErrNetwork, ErrTimeout, ErrStall:
+		return RetryDecision{Retry: true}
+	case ErrLock:
+		return RetryDecision{Retry: true, MinDelay: LockRetryDelay}
+	default:
+		return RetryDecision{}
+	}
+}
+
+// Attempt is a failed try of an operation run through Retry.
+type Attempt struct {
+	Err   string
+	Class InstallErrorType
+	// Retried is set when another attempt followed this one.
+	Retried bool
+}
+
+// AttemptLog collects the failed attempts of every Retry run with a context
+// from WithAttemptLog.
+type AttemptLog struct {
+	mu       sync.Mutex
+	attempts []Attempt
+}
+
+type attemptLogKey struct{}
+
+func WithAttemptLog(ctx context.Context, log *AttemptLog) context.Context {
+	return context.WithValue(ctx, attemptLogKey{}, log)
+}
+
+func (l *AttemptLog) record(a Attempt) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempts = append(l.attempts, a)
+}
+
+// Failures returns the failed attempts in the order they happened.
+func (l *AttemptLog) Failures() []Attempt {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Attempt(nil), l.attempts...)
+}
+
+// Retries is how many failed attempts were followed by another one.
+func (l *AttemptLog) Retries() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, a := range l.attempts {
+		if a.Retried {
+			n++
+		}
+	}
+	return n
+}
+
+// Retry calls fn until it succeeds, runs out of attempts or fails in a way
+// opts.Classify says is not worth retrying. A timeout or stall also ends the
+// retries early unless the Limits on ctx allow more of them: those failures
+// are slow, and usually repeat. Failed attempts go to ctx's AttemptLog.
 func Retry(ctx context.Context, verbose bool, opts RetryOptions, fn func(context.Context) error) error {
 	attempts := opts.Attempts
 	if attempts <= 0 {
@@ -28,17 +113,32 @@ func Retry(ctx context.Context, verbose bool, opts RetryOptions, fn func(context
 		maxDelay = 5 * time.Second
 	}
 
+	slowRetries := LimitsFrom(ctx).Retries
+	log, _ := ctx.Value(attemptLogKey{}).(*AttemptLog)
+
 	var lastErr error
 	for attempt := 1; attempt <= attempts; attempt++ {
 		if verbose && attempt > 1 {
 			fmt.Printf("Retrying (attempt %d/%d)...\n", attempt, attempts)
 		}
-		if err := fn(ctx); err == nil {
+		err := fn(ctx)
+		if err == nil {
 			return nil
-		} else {
-			lastErr = err
 		}
-		if attempt == attempts {
+		lastErr = err
+
+		decision := RetryDecision{Retry: true}
+		if opts.Classify != nil {
+			decision = opts.Classify(err)
+		}
+		retry := decision.Retry && attempt < attempts && !errors.Is(err, ErrDeadline)
+		if retry && (errors.Is(err, ErrCommandTimedOut) || errors.Is(err, ErrCommandStalled)) {
+			retry = slowRetries > 0
+			slowRetries--
+		}
+		class := ClassifyError("", err, err.Error()).Type
+		log.record(Attempt{Err: err.Error(), Class: class, Retried: retry})
+		if !retry {
 			break
 		}
 
@@ -46,6 +146,10 @@ func Retry(ctx context.Context, verbose bool, opts RetryOptions, fn func(context
 		if sleep > maxDelay {
 			sleep = maxDelay
 		}
+		if sleep < decision.MinDelay {
+			sleep = decision.MinDelay
+		}
+		EmitLine(ctx, fmt.Sprintf("Attempt %d/%d failed (%s), retrying in %s", attempt, attempts, class, sleep.Round(100*time.Millisecond)))
 
 		t := time.NewTimer(sleep)
 		select {
@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -55,3 +56,90 @@ func TestRetryHonorsContextCancel(t *testing.T) {
 		t.Fatalf("expected context.Canceled, got %v", err)
 	}
 }
+
+func TestRetryLimitsSlowFailures(t *testing.T) {
+	cases := []struct {
+		name    string
+		retries int
+		want    int
+	}{
+		{name: "no retries", retries: 0, want: 1},
+		{name: "one retry", retries: 1, want: 2},
+		{name: "capped by attempts", retries: 5, want: 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := WithLimits(context.Background(), Limits{Retries: tc.retries})
+			var calls int
+			err := Retry(ctx, false, RetryOptions{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}, func(ctx context.Context) error {
+				calls++
+				return fmt.Errorf("%w: git clone", ErrCommandStalled)
+			})
+			if !errors.Is(err, ErrCommandStalled) {
+				t.Fatalf("error: got %v", err)
+			}
+			if calls != tc.want {
+				t.Fatalf("calls: got %d want %d", calls, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantDelay time.Duration
+	}{
+		{name: "network", err: errors.New("exit status 6: curl: (6) Could not resolve host: github.com"), wantRetry: true},
+		{name: "timeout", err: fmt.Errorf("%w: brew [install llvm]", ErrCommandTimedOut), wantRetry: true},
+		{name: "lock", err: errors.New("exit status 1: Error: Another active Homebrew process is already in progress."), wantRetry: true, wantDelay: LockRetryDelay},
+		{name: "not found", err: errors.New("exit status 1: Error: No available formula with the name \"nope\"."), wantRetry: false},
+		{name: "permission", err: errors.New("exit status 1: Permission denied @ dir_s_mkdir"), wantRetry: false},
+		{name: "unknown", err: errors.New("exit status 1"), wantRetry: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := RetryTransient(tc.err)
+			if got.Retry != tc.wantRetry || got.MinDelay != tc.wantDelay {
+				t.Fatalf("got %+v want retry=%v delay=%s", got, tc.wantRetry, tc.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetryClassifyStopsAndWaits(t *testing.T) {
+	log := &AttemptLog{}
+	ctx := WithAttemptLog(context.Background(), log)
+	errs := []error{errors.New("busy"), errors.New("gone")}
+	var calls int
+	start := time.Now()
+	err := Retry(ctx, false, RetryOptions{
+		Attempts:  5,
+		BaseDelay: time.Millisecond,
+		MaxDelay:  2 * time.Millisecond,
+		Classify: func(err error) RetryDecision {
+			if err.Error() == "busy" {
+				return RetryDecision{Retry: true, MinDelay: 50 * time.Millisecond}
+			}
+			return RetryDecision{}
+		},
+	}, func(ctx context.Context) error {
+		calls++
+		return errs[calls-1]
+	})
+	if err == nil || err.Error() != "gone" {
+		t.Fatalf("error: got %v want gone", err)
+	}
+	if calls != 2 {
+		t.Fatalf("calls: got %d want 2", calls)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("MinDelay not honoured: retried after %s", d)
+	}
+	failures := log.Failures()
+	if len(failures) != 2 || !failures[0].Retried || failures[1].Retried || log.Retries() != 1 {
+		t.Fatalf("attempt log: got %+v", failures)
+	}
+}
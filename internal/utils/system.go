@@ -2,7 +2,6 @@ package utils
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,11 +10,8 @@ import (
 )
 
 func PreflightChecks(ctx context.Context) error {
-	if runtime.GOOS != "darwin" {
-		return errors.New("macsetup only runs on macOS")
-	}
-	if runtime.GOARCH != "arm64" {
-		return errors.New("macsetup only supports Apple Silicon (arm64)")
+	if err := checkPlatform(runtime.GOOS, runtime.GOARCH); err != nil {
+		return err
 	}
 	if err := ValidateDependencies(); err != nil {
 		return err
@@ -27,6 +23,25 @@ func PreflightChecks(ctx context.Context) error {
 	return nil
 }
 
+// IsMacOS reports whether macsetup runs on macOS, where casks and Xcode CLI tools apply.
+func IsMacOS() bool {
+	return runtime.GOOS == "darwin"
+}
+
+func checkPlatform(goos, goarch string) error {
+	switch goos {
+	case "darwin", "linux":
+	default:
+		return fmt.Errorf("macsetup runs on macOS and Linux, not %s", goos)
+	}
+	switch goarch {
+	case "arm64", "amd64":
+		return nil
+	default:
+		return fmt.Errorf("unsupported architecture: %s", goarch)
+	}
+}
+
 func RequestSudo() error {
 	cmd := exec.Command("sudo", "-v")
 	cmd.Stdin = os.Stdin
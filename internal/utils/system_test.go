@@ -0,0 +1,18 @@
+package utils
+
+import "testing"
+
+func TestCheckPlatform(t *testing.T) {
+	supported := [][2]string{{"darwin", "arm64"}, {"darwin", "amd64"}, {"linux", "amd64"}, {"linux", "arm64"}}
+	for _, p := range supported {
+		if err := checkPlatform(p[0], p[1]); err != nil {
+			t.Fatalf("%s/%s: unexpected error: %v", p[0], p[1], err)
+		}
+	}
+	unsupported := [][2]string{{"windows", "amd64"}, {"linux", "386"}}
+	for _, p := range unsupported {
+		if err := checkPlatform(p[0], p[1]); err == nil {
+			t.Fatalf("%s/%s: expected error", p[0], p[1])
+		}
+	}
+}
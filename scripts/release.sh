@@ -48,11 +48,16 @@ if [[ -n $(git status -s) ]]; then
     fi
 fi
 
-# Build the binary
-echo -e "${BLUE}Step 1/4: Building binary${NC}"
-BINARY_NAME="macsetup-darwin-arm64"
-go build -ldflags "-s -w -X main.version=${VERSION}" -o "bin/${BINARY_NAME}" .
-echo -e "${GREEN}✓${NC} Binary built: bin/${BINARY_NAME}"
+# Build the binaries
+echo -e "${BLUE}Step 1/4: Building binaries${NC}"
+BINARIES=()
+for TARGET in darwin/arm64 darwin/amd64 linux/amd64 linux/arm64; do
+    BINARY_NAME="macsetup-${TARGET%/*}-${TARGET#*/}"
+    GOOS="${TARGET%/*}" GOARCH="${TARGET#*/}" CGO_ENABLED=0 \
+        go build -ldflags "-s -w -X main.version=${VERSION}" -o "bin/${BINARY_NAME}" .
+    BINARIES+=("bin/${BINARY_NAME}")
+    echo -e "${GREEN}✓${NC} Binary built: bin/${BINARY_NAME}"
+done
 echo ""
 
 # Create git tag
@@ -74,11 +79,11 @@ echo ""
 # Upload to GitHub releases
 echo -e "${BLUE}Step 4/4: Uploading to GitHub releases${NC}"
 if gh release view "${VERSION}" >/dev/null 2>&1; then
-    gh release upload "${VERSION}" "bin/${BINARY_NAME}" --clobber
-    echo -e "${GREEN}✓${NC} Binary uploaded to GitHub release"
+    gh release upload "${VERSION}" "${BINARIES[@]}" --clobber
+    echo -e "${GREEN}✓${NC} Binaries uploaded to GitHub release"
 else
-    gh release create "${VERSION}" "bin/${BINARY_NAME}" --title "${VERSION}" --generate-notes
-    echo -e "${GREEN}✓${NC} Release created and binary uploaded${NC}"
+    gh release create "${VERSION}" "${BINARIES[@]}" --title "${VERSION}" --generate-notes
+    echo -e "${GREEN}✓${NC} Release created and binaries uploaded${NC}"
 fi
 echo ""
 